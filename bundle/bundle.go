@@ -0,0 +1,392 @@
+// Package bundle exports signed tarballs of cached releases, and imports them
+// into the cache of instances without access to github.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	manifestName  = "manifest.json"
+	signatureName = "manifest.sig"
+	filesDir      = "files/"
+)
+
+// Errors of importing bundles.
+var (
+	ErrSignature = errors.New("invalid bundle signature")
+	ErrChecksum  = errors.New("bundle file checksum mismatch")
+)
+
+// Config of the ed25519 keys in PEM files, e.g. generated by:
+//
+//	openssl genpkey -algorithm ed25519 -out bundle.key
+//	openssl pkey -in bundle.key -pubout -out bundle.pub
+type Config struct {
+	// PrivateKey signs exported bundles.
+	PrivateKey string `yaml:"privateKey"`
+	// PublicKey verifies imported bundles.
+	PublicKey string `yaml:"publicKey"`
+}
+
+// Manifest is the signed index of a bundle.
+type Manifest struct {
+	RepoURL      string           `json:"repoUrl"`
+	CacheURLBase string           `json:"cacheURLBase"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	Releases     []*cache.Release `json:"releases"`
+	// Files are sha256 of files in bundle by path `version/name`.
+	Files map[string]string `json:"files"`
+}
+
+// Bundler exports and imports bundles of the cache in proxy mode.
+type Bundler struct {
+	cache        *cache.GithubCache
+	repoURL      string
+	cacheURLBase string
+	privateKey   ed25519.PrivateKey
+	publicKey    ed25519.PublicKey
+}
+
+// NewBundler reads the configured keys, exporting or importing fails without the key.
+func NewBundler(conf *Config, c *cache.GithubCache, repoURL string, cacheURLBase string) (*Bundler, error) {
+	b := &Bundler{cache: c, repoURL: repoURL, cacheURLBase: cacheURLBase}
+	if conf.PrivateKey != "" {
+		key, err := readKey(conf.PrivateKey, func(der []byte) (interface{}, error) {
+			return x509.ParsePKCS8PrivateKey(der)
+		})
+		if err != nil {
+			return nil, err
+		}
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("private key is not ed25519")
+		}
+		b.privateKey = privateKey
+	}
+	if conf.PublicKey != "" {
+		key, err := readKey(conf.PublicKey, x509.ParsePKIXPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not ed25519")
+		}
+		b.publicKey = publicKey
+	}
+	return b, nil
+}
+
+func readKey(filename string, parse func(der []byte) (interface{}, error)) (interface{}, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", filename)
+	}
+	return parse(block.Bytes)
+}
+
+// Export writes the bundle of releases of versions, or all releases in history if no version is specified.
+// Assets not cached yet are filled first, and all files in the release cache dir are included.
+func (b *Bundler) Export(ctx context.Context, w io.Writer, versions []string) error {
+	if b.privateKey == nil {
+		return errors.New("no private key to sign bundle")
+	}
+
+	releases := b.cache.LoadReleases()
+	if len(versions) > 0 {
+		releases = nil
+		for _, version := range versions {
+			release, err := b.cache.FindRelease(version)
+			if err != nil {
+				return fmt.Errorf("%s: %w", version, err)
+			}
+			releases = append(releases, release)
+		}
+	}
+	if len(releases) == 0 {
+		return errors.New("no release to bundle")
+	}
+
+	manifest := &Manifest{
+		RepoURL:      b.repoURL,
+		CacheURLBase: b.cacheURLBase,
+		CreatedAt:    time.Now(),
+		Releases:     releases,
+		Files:        make(map[string]string),
+	}
+	var files []string
+	for _, release := range releases {
+		names, err := b.fillRelease(ctx, release)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			file := release.Version + "/" + name
+			sum, err := hashFile(b.cache.AssetFilePath(release, name))
+			if err != nil {
+				return err
+			}
+			manifest.Files[file] = sum
+			files = append(files, file)
+		}
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	if err := writeEntry(tw, manifestName, data); err != nil {
+		return err
+	}
+	if err := writeEntry(tw, signatureName, ed25519.Sign(b.privateKey, data)); err != nil {
+		return err
+	}
+	for _, file := range files {
+		version, name := path.Split(file)
+		release := findRelease(releases, strings.TrimSuffix(version, "/"))
+		if err := writeFileEntry(tw, filesDir+file, b.cache.AssetFilePath(release, name)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	log.Info().Int("releases", len(releases)).Int("files", len(files)).Msg("Exported bundle")
+	return nil
+}
+
+// fillRelease caches assets of the release, returns names of all cached files.
+func (b *Bundler) fillRelease(ctx context.Context, release *cache.Release) ([]string, error) {
+	var assets []*cache.Asset
+	for _, asset := range release.Platforms {
+		assets = append(assets, asset)
+		if asset.Blockmap != nil {
+			assets = append(assets, asset.Blockmap)
+		}
+	}
+	assets = append(assets, release.Nupkgs...)
+	for _, asset := range assets {
+		if err := b.cache.FillAsset(ctx, release, asset); err != nil {
+			return nil, err
+		}
+	}
+
+	infos, err := ioutil.ReadDir(b.cache.AssetFilePath(release, ""))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".tmp") {
+			continue
+		}
+		names = append(names, info.Name())
+	}
+	return names, nil
+}
+
+// Import verifies the bundle and installs its releases into the cache,
+// files are checked against the signed manifest before they are moved into the cache dir.
+func (b *Bundler) Import(ctx context.Context, r io.Reader) (*Manifest, error) {
+	if b.publicKey == nil {
+		return nil, errors.New("no public key to verify bundle")
+	}
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+
+	data, err := readEntry(tr, manifestName)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := readEntry(tr, signatureName)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(b.publicKey, data, sig) {
+		return nil, ErrSignature
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.RepoURL != b.repoURL {
+		return nil, fmt.Errorf("bundle of %s, expected %s", manifest.RepoURL, b.repoURL)
+	}
+
+	imported := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		file := strings.TrimPrefix(hdr.Name, filesDir)
+		sum, ok := manifest.Files[file]
+		if !ok || imported[file] {
+			return nil, fmt.Errorf("unexpected file %s in bundle", hdr.Name)
+		}
+		version, name := path.Split(file)
+		release := findRelease(manifest.Releases, strings.TrimSuffix(version, "/"))
+		if release == nil || name == "" || name == "." || name == ".." {
+			return nil, fmt.Errorf("unexpected file %s in bundle", hdr.Name)
+		}
+		if err := installFile(tr, b.cache.AssetFilePath(release, name), sum); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		imported[file] = true
+	}
+	for file := range manifest.Files {
+		if !imported[file] {
+			return nil, fmt.Errorf("missing file %s in bundle", file)
+		}
+	}
+
+	for _, release := range manifest.Releases {
+		b.rebase(release, manifest.CacheURLBase)
+	}
+	b.cache.Install(ctx, manifest.Releases)
+	log.Info().Int("releases", len(manifest.Releases)).Int("files", len(imported)).Time("created", manifest.CreatedAt).Msg("Imported bundle")
+	return &manifest, nil
+}
+
+// rebase points urls of cached assets from the exporting instance to this one.
+func (b *Bundler) rebase(release *cache.Release, cacheURLBase string) {
+	for _, asset := range release.Platforms {
+		if asset.Yml != nil {
+			asset.Yml.Content = strings.ReplaceAll(asset.Yml.Content, cacheURLBase, b.cacheURLBase)
+		}
+	}
+	if release.AppInstaller != nil {
+		release.AppInstaller.Content = strings.ReplaceAll(release.AppInstaller.Content, cacheURLBase, b.cacheURLBase)
+	}
+	// Packages in RELEASES point to github.
+	for _, asset := range release.Nupkgs {
+		release.RELEASES = strings.ReplaceAll(release.RELEASES, asset.BrowserDownloadURL, b.cache.AssetFileURL(release, asset.Name))
+	}
+}
+
+func findRelease(releases []*cache.Release, version string) *cache.Release {
+	for _, release := range releases {
+		if release.Version == version {
+			return release
+		}
+	}
+	return nil
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeFileEntry(tw *tar.Writer, name string, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// readEntry reads the next entry which should be the name.
+func readEntry(tr *tar.Reader, name string) ([]byte, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Name != name {
+		return nil, fmt.Errorf("expected %s in bundle, got %s", name, hdr.Name)
+	}
+	return ioutil.ReadAll(tr)
+}
+
+// installFile writes the file to a temp path, and moves it to the path if its checksum matches.
+func installFile(r io.Reader, filename string, sum string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	tempPath := filename + ".tmp"
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != sum {
+		err = ErrChecksum
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, filename)
+}
+
+func hashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
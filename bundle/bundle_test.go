@@ -0,0 +1,167 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestKeys writes a new ed25519 key pair in PEM files.
+func writeTestKeys(t *testing.T, dir string) *Config {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+
+	conf := &Config{
+		PrivateKey: filepath.Join(dir, "bundle.key"),
+		PublicKey:  filepath.Join(dir, "bundle.pub"),
+	}
+	require.NoError(t, ioutil.WriteFile(conf.PrivateKey, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600))
+	require.NoError(t, ioutil.WriteFile(conf.PublicKey, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644))
+	return conf
+}
+
+func newTestCache(t *testing.T, dir string, cacheURLBase string) *cache.GithubCache {
+	require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	return cache.NewGithubCache(&cache.GithubConfig{Owner: "panjiang", Repo: "gohazel-testing"}, &cache.Options{
+		CacheDir:      dir,
+		ProxyDownload: true,
+		CacheURLBase:  cacheURLBase,
+		KeepReleases:  5,
+		Offline:       true,
+	})
+}
+
+func newTestRelease(t *testing.T, c *cache.GithubCache, version string) *cache.Release {
+	release := &cache.Release{
+		Version: version,
+		Platforms: map[string]*cache.Asset{
+			"exe": {
+				Name: "App-Setup-" + version + ".exe",
+				Yml:  &cache.LatestYml{Content: "url: http://connected/assets/panjiang/gohazel-testing/" + version + "/App-Setup-" + version + ".exe"},
+			},
+		},
+		Nupkgs: []*cache.Asset{
+			{Name: "App-" + version + "-full.nupkg", BrowserDownloadURL: "https://github.com/panjiang/gohazel-testing/releases/download/" + version + "/App-" + version + "-full.nupkg"},
+		},
+	}
+	release.RELEASES = "SHA1 https://github.com/panjiang/gohazel-testing/releases/download/" + version + "/App-" + version + "-full.nupkg 100"
+	for _, name := range []string{release.Platforms["exe"].Name, release.Nupkgs[0].Name} {
+		filename := c.AssetFilePath(release, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filename, []byte(name), 0644))
+	}
+	return release
+}
+
+func TestBundler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Setenv("MODE", "TESTING")
+	conf := writeTestKeys(t, dir)
+
+	src := newTestCache(t, filepath.Join(dir, "src"), "http://connected/assets")
+	defer src.Stop()
+	src.Install(context.Background(), []*cache.Release{newTestRelease(t, src, "v1.1.0"), newTestRelease(t, src, "v1.0.0")})
+	exporter, err := NewBundler(conf, src, "github.com/panjiang/gohazel-testing", "http://connected/assets")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, exporter.Export(context.Background(), &buf, []string{"1.1.0"}))
+
+	dst := newTestCache(t, filepath.Join(dir, "dst"), "http://isolated/assets")
+	defer dst.Stop()
+	dst.Install(context.Background(), []*cache.Release{newTestRelease(t, dst, "v1.0.0")})
+	importer, err := NewBundler(&Config{PublicKey: conf.PublicKey}, dst, "github.com/panjiang/gohazel-testing", "http://isolated/assets")
+	require.NoError(t, err)
+
+	manifest, err := importer.Import(context.Background(), bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Len(t, manifest.Releases, 1)
+	assert.Len(t, manifest.Files, 2)
+
+	releases := dst.LoadReleases()
+	require.Len(t, releases, 2)
+	latest := releases[0]
+	assert.Equal(t, "v1.1.0", latest.Version)
+	assert.Equal(t, latest, dst.LoadCache())
+	assert.Equal(t, "url: http://isolated/assets/panjiang/gohazel-testing/v1.1.0/App-Setup-v1.1.0.exe", latest.Platforms["exe"].Yml.Content)
+	assert.Equal(t, "SHA1 http://isolated/assets/panjiang/gohazel-testing/v1.1.0/App-v1.1.0-full.nupkg 100", latest.RELEASES)
+	b, err := ioutil.ReadFile(dst.AssetFilePath(latest, "App-Setup-v1.1.0.exe"))
+	require.NoError(t, err)
+	assert.Equal(t, "App-Setup-v1.1.0.exe", string(b))
+
+	// Installed as release data loaded at next startup.
+	b, err = ioutil.ReadFile(filepath.Join(dir, "dst", "release.json"))
+	require.NoError(t, err)
+	var data cache.ReleaseData
+	require.NoError(t, json.Unmarshal(b, &data))
+	assert.Equal(t, "v1.1.0", data.Release.Version)
+	assert.Len(t, data.History, 2)
+}
+
+func TestBundler_Import_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Setenv("MODE", "TESTING")
+	conf := writeTestKeys(t, dir)
+
+	c := newTestCache(t, filepath.Join(dir, "cache"), "http://isolated/assets")
+	defer c.Stop()
+	b, err := NewBundler(conf, c, "github.com/panjiang/gohazel-testing", "http://isolated/assets")
+	require.NoError(t, err)
+	release := newTestRelease(t, c, "v1.0.0")
+
+	// newBundle writes a bundle signed by the key, with the file content of the release.
+	newBundle := func(key ed25519.PrivateKey, repoURL string, content string) []byte {
+		data, err := json.Marshal(&Manifest{
+			RepoURL:  repoURL,
+			Releases: []*cache.Release{release},
+			Files:    map[string]string{"v1.0.0/App-Setup-v1.0.0.exe": "b84f4ec8f6caf8c4a3f8f5fa7b1e7b5bd3f4b0ed2fb3aa4d5c6dd3b3bf7c4e8d"},
+		})
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		require.NoError(t, writeEntry(tw, manifestName, data))
+		require.NoError(t, writeEntry(tw, signatureName, ed25519.Sign(key, data)))
+		require.NoError(t, writeEntry(tw, filesDir+"v1.0.0/App-Setup-v1.0.0.exe", []byte(content)))
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+		return buf.Bytes()
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = b.Import(context.Background(), bytes.NewReader(newBundle(otherKey, "github.com/panjiang/gohazel-testing", "")))
+	assert.Equal(t, ErrSignature, err)
+
+	_, err = b.Import(context.Background(), bytes.NewReader(newBundle(b.privateKey, "github.com/panjiang/other", "")))
+	assert.Error(t, err)
+
+	_, err = b.Import(context.Background(), bytes.NewReader(newBundle(b.privateKey, "github.com/panjiang/gohazel-testing", "tampered")))
+	assert.True(t, errors.Is(err, ErrChecksum), "%v", err)
+	assert.Empty(t, c.LoadReleases())
+	_, err = os.Stat(c.AssetFilePath(release, "App-Setup-v1.0.0.exe.tmp"))
+	assert.True(t, os.IsNotExist(err))
+}
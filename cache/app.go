@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAPIURL is the base url of github api.
+const defaultAPIURL = "https://api.github.com/"
+
+// appTokenRefreshAhead is how long before expiry the installation token is refreshed.
+const appTokenRefreshAhead = 5 * time.Minute
+
+// GithubAppConfig authenticates as a Github App installation instead of a personal token.
+type GithubAppConfig struct {
+	ID             int64 `yaml:"id"`
+	InstallationID int64 `yaml:"installationID"`
+	// PrivateKeyFile is the PEM private key generated for the App.
+	PrivateKeyFile string `yaml:"privateKeyFile"`
+}
+
+// appTokenSource mints JWTs of the App and exchanges them for installation tokens,
+// which are reused until they're about to expire.
+type appTokenSource struct {
+	conf    *GithubAppConfig
+	apiURL  string
+	client  *http.Client
+	mu      sync.Mutex
+	key     *rsa.PrivateKey
+	token   string
+	expiry  time.Time
+	nowFunc func() time.Time
+}
+
+func newAppTokenSource(conf *GithubAppConfig, apiURL string, client *http.Client) *appTokenSource {
+	return &appTokenSource{
+		conf:    conf,
+		apiURL:  apiURL,
+		client:  client,
+		nowFunc: time.Now,
+	}
+}
+
+func (s *appTokenSource) resolve() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.nowFunc().Before(s.expiry.Add(-appTokenRefreshAhead)) {
+		return s.token, nil
+	}
+
+	if s.key == nil {
+		key, err := readRSAPrivateKey(s.conf.PrivateKeyFile)
+		if err != nil {
+			return "", err
+		}
+		s.key = key
+	}
+	jwt, err := s.jwt()
+	if err != nil {
+		return "", err
+	}
+
+	u := strings.TrimSuffix(s.apiURL, "/") + fmt.Sprintf("/app/installations/%d/access_tokens", s.conf.InstallationID)
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("create installation token: %s %s", resp.Status, b)
+	}
+
+	var data struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+	if data.Token == "" {
+		return "", errors.New("empty installation token")
+	}
+	s.token = data.Token
+	s.expiry = data.ExpiresAt
+	return s.token, nil
+}
+
+// jwt returns the JWT signed by the App private key, see
+// https://docs.github.com/en/developers/apps/authenticating-with-github-apps
+func (s *appTokenSource) jwt() (string, error) {
+	now := s.nowFunc()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{
+		// Issued 60 seconds in the past against clock drift.
+		"iat": now.Add(-time.Minute).Unix(),
+		// At most 10 minutes.
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": s.conf.ID,
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// readRSAPrivateKey reads the PKCS1 or PKCS8 key in PEM file.
+func readRSAPrivateKey(filename string) (*rsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", filename)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return rsaKey, nil
+}
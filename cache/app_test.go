@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeGithubApp serves the installation token endpoint, verifying the JWT signed by key.
+func fakeGithubApp(t *testing.T, key *rsa.PrivateKey, expiresAt *time.Time) (*httptest.Server, *int) {
+	issued := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/app/installations/42/access_tokens" {
+			http.NotFound(w, r)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		if len(parts) != 3 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]int64
+		if err := json.Unmarshal(b, &claims); err != nil || claims["iss"] != 7 || claims["exp"]-claims["iat"] > 600 {
+			t.Errorf("unexpected claims: %s", b)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		issued++
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      fmt.Sprintf("ghs_installation%d", issued),
+			"expires_at": expiresAt.Format(time.RFC3339),
+		})
+	}))
+	return srv, &issued
+}
+
+func TestAppTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "app.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(keyFile, pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	srv, issued := fakeGithubApp(t, key, &expiresAt)
+	defer srv.Close()
+
+	s := newAppTokenSource(&GithubAppConfig{ID: 7, InstallationID: 42, PrivateKeyFile: keyFile}, srv.URL+"/", srv.Client())
+	s.nowFunc = func() time.Time { return now }
+
+	token, err := s.resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "ghs_installation1" {
+		t.Errorf("expected token is ghs_installation1, got %q", token)
+	}
+
+	// Reused before expiry.
+	now = now.Add(50 * time.Minute)
+	if token, _ := s.resolve(); token != "ghs_installation1" || *issued != 1 {
+		t.Errorf("expected token is reused, got %q of %d issued", token, *issued)
+	}
+
+	// Refreshed when it's about to expire.
+	now = now.Add(6 * time.Minute)
+	expiresAt = now.Add(time.Hour)
+	if token, _ := s.resolve(); token != "ghs_installation2" {
+		t.Errorf("expected token is refreshed, got %q", token)
+	}
+
+	// Rejected by the wrong key.
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = newAppTokenSource(&GithubAppConfig{ID: 7, InstallationID: 42}, srv.URL, srv.Client())
+	s.key = otherKey
+	if _, err := s.resolve(); err == nil {
+		t.Error("expected error of unauthorized JWT")
+	}
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// AppInstallerPlatforms are platforms which can be updated by `.appinstaller` feed, in order of preference.
+var AppInstallerPlatforms = []string{"msix", "appx"}
+
+var (
+	appInstallerURIReg     = regexp.MustCompile(`Uri="([^"]*)"`)
+	appInstallerRootURIReg = regexp.MustCompile(`(<AppInstaller\b[^>]*?\bUri=")[^"]*(")`)
+)
+
+// AppInstaller stores the `.appinstaller` update feed of MSIX packages.
+type AppInstaller struct {
+	Content            string `json:"content"`
+	BrowserDownloadURL string `json:"URL"`
+}
+
+// ReplaceURL replaces the package url which points to the asset in content.
+func (a *AppInstaller) ReplaceURL(assetName string, u string) {
+	a.Content = appInstallerURIReg.ReplaceAllStringFunc(a.Content, func(attr string) string {
+		uri := appInstallerURIReg.FindStringSubmatch(attr)[1]
+		if path.Base(uri) != assetName {
+			return attr
+		}
+		return `Uri="` + u + `"`
+	})
+}
+
+// WithFeedURL returns content with the url of the feed itself.
+func (a *AppInstaller) WithFeedURL(u string) string {
+	return appInstallerRootURIReg.ReplaceAllString(a.Content, "${1}"+u+"${2}")
+}
+
+type appxIdentity struct {
+	Name                  string `xml:"Name,attr"`
+	Publisher             string `xml:"Publisher,attr"`
+	Version               string `xml:"Version,attr"`
+	ProcessorArchitecture string `xml:"ProcessorArchitecture,attr"`
+}
+
+type appxManifest struct {
+	Identity appxIdentity `xml:"Identity"`
+}
+
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+var appInstallerTemplate = template.Must(template.New("appinstaller").Funcs(template.FuncMap{
+	"xml": escapeXML,
+}).Parse(`<?xml version="1.0" encoding="utf-8"?>
+<AppInstaller xmlns="http://schemas.microsoft.com/appx/appinstaller/2018" Version="{{xml .Identity.Version}}" Uri="">
+  <{{.Element}} Name="{{xml .Identity.Name}}" Publisher="{{xml .Identity.Publisher}}" Version="{{xml .Identity.Version}}"{{if .Identity.ProcessorArchitecture}} ProcessorArchitecture="{{xml .Identity.ProcessorArchitecture}}"{{end}} Uri="{{xml .URI}}" />
+  <UpdateSettings>
+    <OnLaunch HoursBetweenUpdateChecks="0" />
+  </UpdateSettings>
+</AppInstaller>
+`))
+
+// generateAppInstaller generates the feed from the package manifest of cached MSIX file.
+func generateAppInstaller(filename string, packageURL string) (*AppInstaller, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	isBundle := strings.HasSuffix(filename, "bundle")
+	manifestName := "AppxManifest.xml"
+	element := "MainPackage"
+	if isBundle {
+		manifestName = "AppxMetadata/AppxBundleManifest.xml"
+		element = "MainBundle"
+	}
+
+	var manifest appxManifest
+	found := false
+	for _, f := range r.File {
+		if f.Name != manifestName {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		err = xml.NewDecoder(rc).Decode(&manifest)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		break
+	}
+	if !found {
+		return nil, errors.New("no package manifest")
+	}
+
+	var buf bytes.Buffer
+	if err := appInstallerTemplate.Execute(&buf, map[string]interface{}{
+		"Identity": manifest.Identity,
+		"Element":  element,
+		"URI":      packageURL,
+	}); err != nil {
+		return nil, err
+	}
+	return &AppInstaller{Content: buf.String()}, nil
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var appInstallerContent = `<?xml version="1.0" encoding="utf-8"?>
+<AppInstaller xmlns="http://schemas.microsoft.com/appx/appinstaller/2018" Version="1.0.0.0" Uri="https://example.com/App.appinstaller">
+  <MainPackage Name="App" Publisher="CN=App" Version="1.0.0.0" ProcessorArchitecture="x64" Uri="https://github.com/panjiang/app/releases/download/v1.0.0/App-1.0.0.msix" />
+</AppInstaller>
+`
+
+func TestAppInstaller_ReplaceURL(t *testing.T) {
+	a := &AppInstaller{Content: appInstallerContent}
+	a.ReplaceURL("App-1.0.0.msix", "http://localhost:8400/assets/panjiang/app/v1.0.0/App-1.0.0.msix")
+	content := a.WithFeedURL("http://localhost:8400/appinstaller")
+
+	if !strings.Contains(content, `Uri="http://localhost:8400/assets/panjiang/app/v1.0.0/App-1.0.0.msix"`) {
+		t.Errorf("Package url is not replaced: %s", content)
+	}
+	if !strings.Contains(content, `Version="1.0.0.0" Uri="http://localhost:8400/appinstaller"`) {
+		t.Errorf("Feed url is not replaced: %s", content)
+	}
+}
+
+func TestGenerateAppInstaller(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), "gohazel-App-1.0.0.msix")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	w := zip.NewWriter(f)
+	mw, _ := w.Create("AppxManifest.xml")
+	mw.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<Package xmlns="http://schemas.microsoft.com/appx/manifest/foundation/windows10">
+  <Identity Name="App" Publisher="CN=App &amp; Co" Version="1.0.0.0" ProcessorArchitecture="x64" />
+</Package>`))
+	w.Close()
+	f.Close()
+
+	a, err := generateAppInstaller(filename, "http://localhost:8400/assets/App-1.0.0.msix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<MainPackage Name="App" Publisher="CN=App &amp; Co" Version="1.0.0.0" ProcessorArchitecture="x64" Uri="http://localhost:8400/assets/App-1.0.0.msix" />`,
+		`<AppInstaller xmlns="http://schemas.microsoft.com/appx/appinstaller/2018" Version="1.0.0.0" Uri="">`,
+	} {
+		if !strings.Contains(a.Content, s) {
+			t.Errorf("Expected %s in %s", s, a.Content)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package cache
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +15,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -22,15 +25,6 @@ import (
 	"golang.org/x/oauth2"
 )
 
-var directCache = map[string]struct{}{
-	"darwin":   {},
-	"exe":      {},
-	"dmg":      {},
-	"rpm":      {},
-	"deb":      {},
-	"AppImage": {},
-}
-
 func checkLatestYmlPlatform(filename string) string {
 	if strings.Contains(filename, "win") || filename == "latest.yml" {
 		return "exe"
@@ -40,29 +34,59 @@ func checkLatestYmlPlatform(filename string) string {
 		return "darwin"
 	}
 	if strings.Contains(filename, "linux") {
-		return "AppImage"
+		return WithArch("AppImage", checkArch(filename))
 	}
 
 	return ""
 }
 
-func checkPlatform(filename string) string {
-	extension := filepath.Ext(filename)
-	extension = strings.TrimLeft(extension, ".")
-	if (strings.Contains(filename, "mac") || strings.Contains(filename, "darwin")) && extension == "zip" {
-		return "darwin"
-	}
+// linuxFormats are platforms which have arch specific assets.
+var linuxFormats = map[string]struct{}{
+	"rpm":             {},
+	"deb":             {},
+	"AppImage":        {},
+	"AppImage.tar.gz": {},
+	"snap":            {},
+	"tar.gz":          {},
+	"linux-zip":       {},
+}
 
-	_, ok := directCache[extension]
-	if ok {
-		return extension
+// checkArch parses ARM arch from filename, returns empty string for x86.
+func checkArch(filename string) string {
+	filename = strings.ToLower(filename)
+	switch {
+	case strings.Contains(filename, "arm64") || strings.Contains(filename, "aarch64"):
+		return "arm64"
+	case strings.Contains(filename, "armv7l") || strings.Contains(filename, "armhf"):
+		return "armv7l"
 	}
-
 	return ""
 }
 
+// WithArch appends arch suffix to Linux platforms, e.g. `deb-arm64`.
+func WithArch(platform string, arch string) string {
+	if _, ok := linuxFormats[platform]; !ok || arch == "" {
+		return platform
+	}
+	return platform + "-" + arch
+}
+
 var latestYmlURLReg = regexp.MustCompile(`url:\s+([\w-.]+)`)
 
+// latestYmlPathReg matches the installer of latest yml, e.g. `path: App-Setup-1.0.0.exe`.
+var latestYmlPathReg = regexp.MustCompile(`(?m)^path:\s+(\S+)`)
+
+// latestYmlInstaller returns the installer name in latest yml, the path or the first file url.
+func latestYmlInstaller(content string) string {
+	if m := latestYmlPathReg.FindStringSubmatch(content); m != nil {
+		return strings.Trim(m[1], `'"`)
+	}
+	if m := latestYmlURLReg.FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
 // LatestYml stores asset update info of specific platform.
 type LatestYml struct {
 	Content            string `json:"content"`
@@ -76,29 +100,63 @@ func (yml *LatestYml) ReplaceURL(u string) {
 
 // Asset is the released package.
 type Asset struct {
-	ID                 int64      `json:"id"`
-	Name               string     `json:"name"`
-	URL                string     `json:"url"`
-	BrowserDownloadURL string     `json:"browserDownloadURL"`
-	ContentType        string     `json:"contentType"`
-	Size               int        `json:"size"`
-	Yml                *LatestYml `json:"latestYml"`
+	ID                 int64            `json:"id"`
+	Name               string           `json:"name"`
+	URL                string           `json:"url"`
+	BrowserDownloadURL string           `json:"browserDownloadURL"`
+	ContentType        string           `json:"contentType"`
+	Size               int              `json:"size"`
+	Length             int              `json:"length"`
+	UpdatedAt          github.Timestamp `json:"updatedAt"`
+	Yml                *LatestYml       `json:"latestYml"`
+	Signature          string           `json:"signature,omitempty"`
+	Blockmap           *Asset           `json:"blockmap,omitempty"`
 }
 
 // Release contains major info of every release record.
 type Release struct {
-	Version   string            `json:"version"`
-	Notes     string            `json:"notes"`
-	PubDate   github.Timestamp  `json:"pubDate"`
-	Platforms map[string]*Asset `json:"platforms"`
-	RELEASES  string            `json:"RELEASES"`
+	Version      string            `json:"version"`
+	Tag          string            `json:"tag,omitempty"`
+	Notes        string            `json:"notes"`
+	PubDate      github.Timestamp  `json:"pubDate"`
+	HTMLURL      string            `json:"htmlURL"`
+	Meta         *ReleaseMeta      `json:"meta,omitempty"`
+	Platforms    map[string]*Asset `json:"platforms"`
+	RELEASES     string            `json:"RELEASES"`
+	AppInstaller *AppInstaller     `json:"appInstaller,omitempty"`
+	Conflicts    []string          `json:"conflicts,omitempty"`
+	Nupkgs       []*Asset          `json:"nupkgs,omitempty"`
 }
 
 // ReleaseData release info data for caching into file.
 type ReleaseData struct {
-	Release       *Release `json:"release"`
-	RepoURL       string   `json:"repoUrl"`
-	ProxyDownload bool     `json:"proxyDownload"`
+	Release       *Release   `json:"release"`
+	History       []*Release `json:"history"`
+	RepoURL       string     `json:"repoUrl"`
+	ProxyDownload bool       `json:"proxyDownload"`
+}
+
+// Errors of finding a release in history.
+var (
+	ErrReleaseNotFound = errors.New("release not found")
+	ErrReleaseBlocked  = errors.New("release is blocked")
+)
+
+// Options of the cache.
+type Options struct {
+	CacheDir        string
+	ProxyDownload   bool
+	CacheURLBase    string
+	KeepReleases    int
+	BlockedVersions []string
+	PlatformRules   []PlatformRule
+	// Offline serves the cached release data only, without refreshing from github.
+	Offline bool
+	Refresh SchedulerConfig
+	// Lines whose latest releases are kept in history besides the latest ones.
+	Lines []Line
+	// SteppingStones are kept in history besides the latest ones.
+	SteppingStones []SteppingStone
 }
 
 // ProxyDownloadConfig of proxy download files with current server.
@@ -112,21 +170,63 @@ type GithubConfig struct {
 	Owner string `yaml:"owner"`
 	Repo  string `yaml:"repo"`
 	Token string `yaml:"token"`
+	// TokenFile is read for the token, and read again after it's changed.
+	TokenFile string `yaml:"tokenFile"`
+	// TokenCommand is the credential helper printing the token, e.g. `["vault", "read", "-field=token", "secret/github"]`.
+	TokenCommand []string        `yaml:"tokenCommand"`
+	App          GithubAppConfig `yaml:"app"`
+	// APIURL and UploadURL of Github Enterprise Server, e.g. `https://github.example.com/api/v3/`.
+	APIURL    string `yaml:"apiURL"`
+	UploadURL string `yaml:"uploadURL"`
+	// CAFile is the PEM bundle of CAs trusted besides the system ones.
+	CAFile string `yaml:"caFile"`
+	// Proxy is the HTTP proxy url, default from `HTTPS_PROXY` environment.
+	Proxy string `yaml:"proxy"`
+	// Latest is the policy of selecting the latest release, `semver` by default or `github`.
+	Latest string `yaml:"latest"`
+	// WebhookSecret verifies payloads of the repo webhook, which triggers refreshing on release events.
+	WebhookSecret string `yaml:"webhookSecret"`
+	// EnvToken is from `GITHUB_TOKEN` environment, it authenticates api requests and asset
+	// downloads as a configured token, but doesn't require proxy download for public repos.
+	EnvToken      string `yaml:"-"`
+	ReleaseFilter `yaml:",inline"`
 }
 
 // RepoURL returns repo URL on github.
 func (c *GithubConfig) RepoURL() string {
-	return fmt.Sprintf("github.com/%s/%s", c.Owner, c.Repo)
+	return fmt.Sprintf("%s/%s/%s", c.Host(), c.Owner, c.Repo)
 }
 
 // IsPrivateRepo if is private repo should proxy assets download.
 func (c *GithubConfig) IsPrivateRepo() bool {
-	return c.Token != ""
+	return c.Token != "" || c.App.ID != 0 || c.TokenFile != "" || len(c.TokenCommand) > 0
+}
+
+// HasToken reports whether api requests and asset downloads are authenticated.
+func (c *GithubConfig) HasToken() bool {
+	return c.IsPrivateRepo() || c.EnvToken != ""
 }
 
+// Policies of selecting the latest release.
+const (
+	// LatestSemver selects the highest version of the stable channel.
+	LatestSemver = "semver"
+	// LatestGithub selects the release marked latest on github, by `make_latest` when it's published.
+	LatestGithub = "github"
+)
+
+// Paging of listing releases.
+const (
+	releasesPerPage = 100
+	maxReleasePages = 10
+)
+
+// RefreshHook is called with releases in history after they are changed,
+// ctx is done when the refresh is canceled or the cache is stopped.
+type RefreshHook func(ctx context.Context, releases []*Release)
+
 // GithubCache caches release information fetching from github.
 type GithubCache struct {
-	quitCh        chan struct{}
 	wg            sync.WaitGroup
 	mu            sync.Mutex
 	closed        bool
@@ -134,26 +234,119 @@ type GithubCache struct {
 	cacheURLBase  string
 	proxyDownload bool
 	cacheDir      string
+	keepReleases  int
+	lines         []Line
+	stones        []SteppingStone
+	blocked       map[string]struct{}
+	classifier    *Classifier
+	filter        *Filter
 	latest        *Release
+	history       []*Release
 	latestMu      sync.RWMutex
-	latestUpdate  time.Time
+	// historyMu is held from reading history to writing the merged one by refreshing and installing.
+	historyMu sync.Mutex
+	scheduler *Scheduler
+	// fillMu guards fills and sums.
+	fillMu sync.Mutex
+	// fills are locks of asset files being filled by path.
+	fills map[string]*fillLock
+	// sums are sha256 of cached asset files by path.
+	sums       map[string]string
+	tokens     *tokenSource
+	httpClient *http.Client
+	api        *apiTransport
+	hooks      []RefreshHook
+	hooksMu    sync.Mutex
+	apps       []*GithubCache
+	// ctx is canceled when the cache is stopped.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewGithubCache .
-func NewGithubCache(conf *GithubConfig, cacheDir string, proxyDownload bool, cacheURLBase string) *GithubCache {
+func NewGithubCache(conf *GithubConfig, opts *Options) *GithubCache {
+	g := newGithubCache(conf, opts)
+	httpClient, err := conf.HTTPClient()
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid github client config, use default")
+		httpClient = &http.Client{}
+	}
+	g.httpClient = httpClient
+	g.tokens = newTokenSource(conf, httpClient)
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	g.api = newAPITransport(transport)
+	log.Info().Str("url", conf.RepoURL()).Bool("private", conf.IsPrivateRepo()).Msg("Github repo")
+
+	g.start(opts)
+	return g
+}
+
+// NewApp returns the cache of another app released in the same repo, selected by the filter.
+// It shares the api client and rate limit of g, and is refreshed and stopped along with g.
+func (g *GithubCache) NewApp(name string, filter *ReleaseFilter, opts *Options) *GithubCache {
+	conf := *g.conf
+	conf.ReleaseFilter = *filter
+	app := newGithubCache(&conf, opts)
+	app.httpClient = g.httpClient
+	app.tokens = g.tokens
+	app.api = g.api
+	log.Info().Str("app", name).Str("tagPrefix", filter.TagPrefix).Str("tagPattern", filter.TagPattern).Msg("Github app")
+
+	app.start(opts)
+	g.mu.Lock()
+	g.apps = append(g.apps, app)
+	g.mu.Unlock()
+	return app
+}
+
+func newGithubCache(conf *GithubConfig, opts *Options) *GithubCache {
 	g := &GithubCache{
-		quitCh:        make(chan struct{}),
 		conf:          conf,
-		proxyDownload: proxyDownload,
-		cacheURLBase:  cacheURLBase,
-		cacheDir:      cacheDir,
+		proxyDownload: opts.ProxyDownload,
+		cacheURLBase:  opts.CacheURLBase,
+		cacheDir:      opts.CacheDir,
+		keepReleases:  opts.KeepReleases,
+		lines:         opts.Lines,
+		stones:        opts.SteppingStones,
+		blocked:       make(map[string]struct{}),
+		fills:         make(map[string]*fillLock),
+		sums:          make(map[string]string),
 	}
-	log.Info().Str("url", conf.RepoURL()).Bool("private", conf.IsPrivateRepo()).Msg("Github repo")
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	if g.keepReleases < 1 {
+		g.keepReleases = 1
+	}
+	for _, v := range opts.BlockedVersions {
+		g.blocked[canonicalVersion(v)] = struct{}{}
+	}
+	classifier, err := NewClassifier(opts.PlatformRules)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid platform rules, use default")
+		classifier, _ = NewClassifier(nil)
+	}
+	g.classifier = classifier
+	filter, err := NewFilter(&conf.ReleaseFilter)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid release filter, use none")
+		filter, _ = NewFilter(&ReleaseFilter{})
+	}
+	g.filter = filter
+	return g
+}
 
+// start loads the cached release data, and refreshes it in background if it's not offline.
+func (g *GithubCache) start(opts *Options) {
 	g.loadReleaseCache()
-	g.wg.Add(1)
-	go g.runRefreshLoop()
-	return g
+	if opts.Offline {
+		return
+	}
+	g.scheduler = NewScheduler(opts.Refresh, g.refreshCache, func() time.Duration {
+		return g.RateLimit().Wait(time.Now())
+	})
+	g.scheduler.Start()
 }
 
 // Stop the cache services.
@@ -164,14 +357,25 @@ func (g *GithubCache) Stop() {
 		return
 	}
 	g.closed = true
+	apps := g.apps
 	g.mu.Unlock()
-	close(g.quitCh)
+	for _, app := range apps {
+		app.Stop()
+	}
+	g.cancel()
+	if g.scheduler != nil {
+		g.scheduler.Stop()
+	}
 	g.wg.Wait()
 }
 
 // AssetFilePath generates file path for caching asset.
 func (g *GithubCache) AssetFilePath(release *Release, assetName string) string {
-	return filepath.Join(g.cacheDir, g.conf.Owner, g.conf.Repo, release.Version, assetName)
+	return filepath.Join(g.releaseDir(release), assetName)
+}
+
+func (g *GithubCache) releaseDir(release *Release) string {
+	return filepath.Join(g.cacheDir, g.conf.Owner, g.conf.Repo, release.Version)
 }
 
 // AssetFileURL generates file download url of cached asset.
@@ -182,159 +386,448 @@ func (g *GithubCache) AssetFileURL(release *Release, assetName string) string {
 }
 
 func (g *GithubCache) newClient(ctx context.Context) *github.Client {
-	if g.conf.Token == "" {
-		return github.NewClient(nil)
-
+	httpClient := &http.Client{Transport: g.api}
+	if g.conf.HasToken() {
+		httpClient = oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, httpClient), g.tokens)
+	}
+	if g.conf.APIURL == "" {
+		return github.NewClient(httpClient)
 	}
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: g.conf.Token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	return github.NewClient(tc)
+	client, err := github.NewEnterpriseClient(g.conf.APIBaseURL(), g.conf.UploadBaseURL(), httpClient)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid github enterprise url")
+		return github.NewClient(httpClient)
+	}
+	return client
 }
 
-func (g *GithubCache) refreshCache() error {
-	ctx := context.Background()
+func (g *GithubCache) refreshCache(ctx context.Context) error {
 	client := g.newClient(ctx)
-	releases, _, err := client.Repositories.ListReleases(ctx, g.conf.Owner, g.conf.Repo, &github.ListOptions{
-		PerPage: 10,
-	})
-
+	releases, err := g.listReleases(ctx, client)
 	if err != nil {
-		if _, ok := err.(*github.RateLimitError); ok {
-			log.Error().Msg("hit rate limit")
+		switch e := err.(type) {
+		case *github.RateLimitError:
+			log.Error().Time("reset", e.Rate.Reset.Time).Msg("Hit rate limit")
+		case *github.AbuseRateLimitError:
+			if e.RetryAfter != nil {
+				g.api.retryAfter(time.Now().Add(*e.RetryAfter))
+			}
+			log.Error().Msg("Hit secondary rate limit")
 		}
 		return err
 	}
+	if len(releases) == 0 {
+		return nil
+	}
+
+	// Ordered by semver instead of publishing, a hotfix of an old line may be published after a newer one.
+	sort.SliceStable(releases, func(i, j int) bool {
+		return compareVersions(g.releaseVersion(releases[i]), g.releaseVersion(releases[j])) > 0
+	})
+	items := make(map[*Release]*github.RepositoryRelease)
+	var candidates []*Release
+	for _, item := range releases {
+		candidate := g.candidateRelease(item)
+		items[candidate] = item
+		candidates = append(candidates, candidate)
+	}
+	candidates = g.trimHistory(candidates)
+	releases = releases[:0]
+	for _, candidate := range candidates {
+		releases = append(releases, items[candidate])
+	}
+	latestTag := *items[latestRelease(candidates)].TagName
+
+	g.historyMu.Lock()
+	defer g.historyMu.Unlock()
+	historyPrev := g.LoadReleases()
 
-	var release *github.RepositoryRelease
+	var history []*Release
+	changed := len(historyPrev) == 0
 	for _, item := range releases {
-		if *item.Draft {
+		if prev := findRelease(historyPrev, g.releaseVersion(item)); prev != nil && prev.PubDate.Equal(*item.PublishedAt) {
+			history = append(history, prev)
 			continue
 		}
-		if *item.Prerelease {
-			continue
+
+		// Only assets of the latest release are downloaded ahead,
+		// older ones are filled when they are requested.
+		release, err := g.buildRelease(ctx, item, *item.TagName == latestTag)
+		if err != nil {
+			return err
+		}
+		history = append(history, release)
+		changed = true
+	}
+
+	if !changed && len(history) == len(historyPrev) {
+		return nil
+	}
+
+	g.setHistory(ctx, historyPrev, history)
+	log.Info().Str("version", latestRelease(history).Version).Int("history", len(history)).Msg("Finished caching")
+	return nil
+}
+
+// listReleases pages through releases of the repo, until there are enough ones to keep,
+// one of the stable channel, ones of all defined lines and the stepping stones, or there is no more page.
+// With `latest: github`, stable releases newer than the one marked latest on github are skipped.
+func (g *GithubCache) listReleases(ctx context.Context, client *github.Client) ([]*github.RepositoryRelease, error) {
+	var marked *github.RepositoryRelease
+	if g.conf.Latest == LatestGithub {
+		release, resp, err := client.Repositories.GetLatestRelease(ctx, g.conf.Owner, g.conf.Repo)
+		if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+			return nil, err
+		}
+		// The marked one may be of another app in the repo, which doesn't limit this one.
+		if release != nil {
+			if _, ok := g.filter.Version(release.GetTagName()); ok {
+				marked = release
+			}
+		}
+	}
+
+	var candidates []*github.RepositoryRelease
+	var found []*Release
+	stable := false
+	add := func(item *github.RepositoryRelease) {
+		if !g.isCandidate(item) || findGithubRelease(candidates, *item.TagName) != nil {
+			return
+		}
+		candidate := g.candidateRelease(item)
+		isStable := candidate.Channel() == StableChannel
+		if marked != nil && isStable && compareVersions(candidate.Version, g.releaseVersion(marked)) > 0 {
+			log.Debug().Str("tag", *item.TagName).Str("latest", *marked.TagName).Msg("Newer than the latest marked on github, skip")
+			return
+		}
+		candidates = append(candidates, item)
+		found = append(found, candidate)
+		stable = stable || isStable
+	}
+
+	opts := &github.ListOptions{PerPage: releasesPerPage}
+	for page := 0; page < maxReleasePages; page++ {
+		releases, resp, err := client.Repositories.ListReleases(ctx, g.conf.Owner, g.conf.Repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range releases {
+			add(item)
+		}
+		if resp.NextPage == 0 || (stable && len(candidates) >= g.keepReleases && g.hasKept(found)) {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	// The marked one may be older than the listed pages.
+	if marked != nil {
+		add(marked)
+	}
+	return candidates, nil
+}
+
+// isCandidate reports whether the github release is of the app and can be served.
+func (g *GithubCache) isCandidate(item *github.RepositoryRelease) bool {
+	if item.GetDraft() || item.GetPrerelease() || item.PublishedAt == nil {
+		return false
+	}
+	version, ok := g.filter.Version(item.GetTagName())
+	if !ok || g.IsBlocked(version) {
+		return false
+	}
+	for _, asset := range item.Assets {
+		if g.filter.MatchAsset(asset.GetName()) {
+			return true
 		}
-		if len(item.Assets) == 0 {
+	}
+	return false
+}
+
+// releaseVersion returns the version extracted from the tag of the github release.
+func (g *GithubCache) releaseVersion(item *github.RepositoryRelease) string {
+	if version, ok := g.filter.Version(item.GetTagName()); ok {
+		return version
+	}
+	return item.GetTagName()
+}
+
+func findGithubRelease(releases []*github.RepositoryRelease, tag string) *github.RepositoryRelease {
+	for _, release := range releases {
+		if *release.TagName == tag {
+			return release
+		}
+	}
+	return nil
+}
+
+// candidateRelease returns the release of the version and meta only, for selecting it before it's built.
+func (g *GithubCache) candidateRelease(item *github.RepositoryRelease) *Release {
+	r := &Release{Version: g.releaseVersion(item)}
+	r.Meta, _ = parseFrontMatter(item.GetBody())
+	return r
+}
+
+// setHistory replaces release history, and cleans cached assets of releases out of it.
+func (g *GithubCache) setHistory(ctx context.Context, historyPrev []*Release, history []*Release) {
+	latest := latestRelease(history)
+	g.latestMu.Lock()
+	g.latest = latest
+	g.history = history
+	g.latestMu.Unlock()
+
+	// Clean cached assets of releases out of history.
+	for _, prev := range historyPrev {
+		if findRelease(history, prev.Version) != nil {
 			continue
 		}
-		release = item
-		break
+		dir := g.releaseDir(prev)
+		if err := os.RemoveAll(dir); err != nil {
+			log.Error().Err(err).Str("dir", dir).Msg("Remove old release")
+		}
 	}
 
-	if release == nil {
-		return nil
+	for _, release := range history {
+		g.fillBlockmaps(ctx, release)
 	}
 
-	g.latestMu.RLock()
-	latestPrev := g.latest
-	g.latestMu.RUnlock()
+	// Cache release data for loading as basic data at next startup.
+	// In case there is no any data while network error occurred at startup.
+	g.cacheReleaseLastest(latest, history)
+	g.runRefreshHooks(ctx, history)
+}
 
-	if latestPrev != nil && latestPrev.Version == *release.TagName && latestPrev.PubDate.Equal(*release.PublishedAt) {
-		g.latestUpdate = time.Now()
-		return nil
+// Install merges releases into history as if they are fetched from github,
+// their assets should be in cache dir already. Releases of the same versions are replaced,
+// and history is ordered by semver and trimmed as refreshed.
+func (g *GithubCache) Install(ctx context.Context, releases []*Release) {
+	g.historyMu.Lock()
+	defer g.historyMu.Unlock()
+	historyPrev := g.LoadReleases()
+	var history []*Release
+	for _, release := range releases {
+		if !g.IsBlocked(release.Version) {
+			history = append(history, release)
+		}
+	}
+	for _, prev := range historyPrev {
+		if findRelease(history, prev.Version) == nil {
+			history = append(history, prev)
+		}
+	}
+	if len(history) == 0 {
+		return
 	}
 
-	latest := &Release{
-		Version:   *release.TagName,
-		Notes:     *release.Body,
+	sort.SliceStable(history, func(i, j int) bool {
+		return compareVersions(history[i].Version, history[j].Version) > 0
+	})
+	history = g.trimHistory(history)
+
+	g.setHistory(ctx, historyPrev, history)
+	log.Info().Str("version", latestRelease(history).Version).Int("history", len(history)).Msg("Installed releases")
+}
+
+func (g *GithubCache) buildRelease(ctx context.Context, release *github.RepositoryRelease, cacheAssets bool) (*Release, error) {
+	r := &Release{
+		Version:   g.releaseVersion(release),
 		PubDate:   *release.PublishedAt,
+		HTMLURL:   release.GetHTMLURL(),
 		Platforms: make(map[string]*Asset),
 	}
-	log.Info().Str("version", latest.Version).Msg("Caching...")
+	if r.Version != *release.TagName {
+		r.Tag = *release.TagName
+	}
+	r.Meta, r.Notes = parseFrontMatter(*release.Body)
+	log.Info().Str("version", r.Version).Msg("Caching...")
 
+	// Latest ymls by their installers, or by platforms of the filenames if there is no installer.
+	installerYmls := map[string]*LatestYml{}
 	platformYmls := map[string]*LatestYml{}
+	signatures := map[string]string{}
+	blockmaps := map[string]*Asset{}
 	for _, asset := range release.Assets {
+		if !g.filter.MatchAsset(*asset.Name) {
+			continue
+		}
 		if *asset.Name == "RELEASES" {
 			log.Debug().Interface("asset", asset).Msg("RELEASES")
 			content, err := g.fetchFileRELEASES(ctx, *asset.ID, *asset.BrowserDownloadURL)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
-			latest.RELEASES = content
+			r.RELEASES = content
+			continue
+		}
+
+		// MSIX update feed.
+		if filepath.Ext(*asset.Name) == ".appinstaller" {
+			content, err := g.fetchAssetContent(ctx, *asset.ID, *asset.BrowserDownloadURL)
+			if err != nil {
+				return nil, err
+			}
+			r.AppInstaller = &AppInstaller{
+				Content:            content,
+				BrowserDownloadURL: *asset.BrowserDownloadURL,
+			}
+			log.Info().Str("asset", *asset.Name).Msg("Cache appinstaller")
 			continue
 		}
 
 		// latest-[win/mac/linux].yml
 		if filepath.Ext(*asset.Name) == ".yml" {
-			platform := checkLatestYmlPlatform(*asset.Name)
-			if platform == "" {
-				continue
-			}
 			content, err := g.fetchFileLatestYml(ctx, *asset.ID, *asset.BrowserDownloadURL)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			platformYmls[platform] = &LatestYml{
+			yml := &LatestYml{
 				Content:            content,
 				BrowserDownloadURL: *asset.BrowserDownloadURL,
 			}
-			log.Info().Str("asset", *asset.Name).Str("platform", platform).Msg("Cache latest yml")
+			if installer := latestYmlInstaller(content); installer != "" {
+				installerYmls[installer] = yml
+				log.Info().Str("asset", *asset.Name).Str("installer", installer).Msg("Cache latest yml")
+			} else if platform := checkLatestYmlPlatform(*asset.Name); platform != "" {
+				platformYmls[platform] = yml
+				log.Info().Str("asset", *asset.Name).Str("platform", platform).Msg("Cache latest yml")
+			}
+			continue
+		}
+
+		// EdDSA signature of the sidecar asset, e.g. `App-mac.zip.sig`.
+		if filepath.Ext(*asset.Name) == ".sig" {
+			content, err := g.fetchAssetContent(ctx, *asset.ID, *asset.BrowserDownloadURL)
+			if err != nil {
+				return nil, err
+			}
+			signatures[strings.TrimSuffix(*asset.Name, ".sig")] = strings.TrimSpace(content)
+			log.Info().Str("asset", *asset.Name).Msg("Cache signature")
+			continue
+		}
+
+		// Squirrel packages listed in RELEASES.
+		if filepath.Ext(*asset.Name) == ".nupkg" {
+			r.Nupkgs = append(r.Nupkgs, newAsset(asset))
+			continue
+		}
+
+		// Blockmap for differential update of electron-updater, e.g. `App-Setup-1.0.0.exe.blockmap`.
+		if filepath.Ext(*asset.Name) == ".blockmap" {
+			blockmaps[strings.TrimSuffix(*asset.Name, ".blockmap")] = newAsset(asset)
 			continue
 		}
 
-		platform := checkPlatform(*asset.Name)
+		platform := g.classifier.Classify(*asset.Name)
 		if platform == "" {
 			continue
 		}
 
-		a := &Asset{
-			ID:                 *asset.ID,
-			Name:               *asset.Name,
-			URL:                *asset.URL,
-			BrowserDownloadURL: *asset.BrowserDownloadURL,
-			ContentType:        *asset.ContentType,
-			Size:               (*asset.Size) / 1000000 * 10 / 10,
+		if exist, ok := r.Platforms[platform]; ok {
+			conflict := fmt.Sprintf("%s: %s conflicts with %s", platform, *asset.Name, exist.Name)
+			log.Error().Str("version", r.Version).Str("platform", platform).Str("asset", *asset.Name).Str("exist", exist.Name).Msg("Platform conflict, add a platform rule to disambiguate")
+			r.Conflicts = append(r.Conflicts, conflict)
+			continue
 		}
 
+		a := newAsset(asset)
 		log.Info().Str("asset", *asset.Name).Str("platform", platform).Msg("Cache asset")
 		// Download asset into cache dir.
-		if g.proxyDownload {
-			if err := g.cacheAssetFile(latest, a); err != nil {
-				return err
+		if g.proxyDownload && cacheAssets {
+			if err := g.fillAsset(ctx, r, a); err != nil {
+				return nil, err
 			}
 		}
 
-		latest.Platforms[platform] = a
+		r.Platforms[platform] = a
 	}
 
-	// Bind latest yml to asset.
-	for platform, asset := range latest.Platforms {
-		yml, ok := platformYmls[platform]
+	// Bind latest yml, signature and blockmap to asset.
+	for platform, asset := range r.Platforms {
+		asset.Signature = signatures[asset.Name]
+		asset.Blockmap = blockmaps[asset.Name]
+		yml, ok := installerYmls[asset.Name]
+		if !ok {
+			yml, ok = platformYmls[platform]
+		}
 		if ok {
 			asset.Yml = yml
 			// Replace download url in yaml file.
 			if g.proxyDownload {
-				yml.ReplaceURL(g.AssetFileURL(latest, asset.Name))
+				yml.ReplaceURL(g.AssetFileURL(r, asset.Name))
 			}
 		} else {
 			log.Error().Str("platform", platform).Msg("No latest yml")
 		}
 	}
 
-	g.latestMu.Lock()
-	g.latest = latest
-	g.latestMu.Unlock()
+	g.bindAppInstaller(r, cacheAssets)
+	return r, nil
+}
 
-	// Clean old cached assets.
-	if latestPrev != nil {
-		for _, a := range latestPrev.Platforms {
-			fn := g.AssetFilePath(latestPrev, a.Name)
-			if err := os.Remove(fn); err != nil {
-				log.Error().Err(err).Str("file", fn).Msg("Remove old asset")
-			}
+func newAsset(asset *github.ReleaseAsset) *Asset {
+	return &Asset{
+		ID:                 *asset.ID,
+		Name:               *asset.Name,
+		URL:                *asset.URL,
+		BrowserDownloadURL: *asset.BrowserDownloadURL,
+		ContentType:        *asset.ContentType,
+		Size:               (*asset.Size) / 1000000 * 10 / 10,
+		Length:             *asset.Size,
+		UpdatedAt:          asset.GetUpdatedAt(),
+	}
+}
+
+// fillBlockmaps caches blockmaps of the release in proxy mode,
+// electron-updater requests the ones of both the new and the installed versions
+// from the paths in rewritten latest yml.
+func (g *GithubCache) fillBlockmaps(ctx context.Context, release *Release) {
+	if !g.proxyDownload {
+		return
+	}
+	for _, asset := range release.Platforms {
+		if asset.Blockmap == nil {
+			continue
+		}
+		if err := g.fillAsset(ctx, release, asset.Blockmap); err != nil {
+			log.Error().Err(err).Str("asset", asset.Blockmap.Name).Msg("Cache blockmap")
 		}
 	}
+}
 
-	g.latestUpdate = time.Now()
+// bindAppInstaller points package urls in the uploaded `.appinstaller` feed to proxy urls,
+// or generates the feed from the cached MSIX package if there is no one uploaded.
+func (g *GithubCache) bindAppInstaller(r *Release, cached bool) {
+	if !g.proxyDownload {
+		return
+	}
 
-	// Cache release data for loading as basic data at next startup.
-	// In case there is no any data while network error occurred at startup.
-	g.cacheReleaseLastest(latest)
+	if r.AppInstaller != nil {
+		for _, platform := range AppInstallerPlatforms {
+			if asset, ok := r.Platforms[platform]; ok {
+				r.AppInstaller.ReplaceURL(asset.Name, g.AssetFileURL(r, asset.Name))
+			}
+		}
+		return
+	}
 
-	log.Info().Str("version", latest.Version).Msg("Finished caching")
-	return nil
+	if !cached {
+		return
+	}
+	for _, platform := range AppInstallerPlatforms {
+		asset, ok := r.Platforms[platform]
+		if !ok {
+			continue
+		}
+		appInstaller, err := generateAppInstaller(g.AssetFilePath(r, asset.Name), g.AssetFileURL(r, asset.Name))
+		if err != nil {
+			log.Error().Err(err).Str("asset", asset.Name).Msg("Generate appinstaller")
+			return
+		}
+		r.AppInstaller = appInstaller
+		log.Info().Str("asset", asset.Name).Msg("Generated appinstaller")
+		return
+	}
 }
 
 func (g *GithubCache) loadReleaseCache() {
@@ -363,12 +856,22 @@ func (g *GithubCache) loadReleaseCache() {
 	}
 
 	g.latest = data.Release
+	for i, release := range data.History {
+		if release.Version == data.Release.Version {
+			data.History[i] = data.Release
+		}
+	}
+	g.history = data.History
+	if len(g.history) == 0 {
+		g.history = []*Release{data.Release}
+	}
 	log.Info().Str("version", g.latest.Version).Str("file", filename).Msg("Loaded release data from cache")
 }
 
-func (g *GithubCache) cacheReleaseLastest(release *Release) {
+func (g *GithubCache) cacheReleaseLastest(release *Release, history []*Release) {
 	data := &ReleaseData{
 		Release:       release,
+		History:       history,
 		RepoURL:       g.conf.RepoURL(),
 		ProxyDownload: g.proxyDownload,
 	}
@@ -385,7 +888,7 @@ func (g *GithubCache) cacheReleaseLastest(release *Release) {
 	}
 }
 
-func (g *GithubCache) cacheAssetFile(release *Release, asset *Asset) error {
+func (g *GithubCache) cacheAssetFile(ctx context.Context, release *Release, asset *Asset) error {
 	assetPath := g.AssetFilePath(release, asset.Name)
 	if _, err := os.Stat(assetPath); err != nil {
 		if !os.IsNotExist(err) {
@@ -401,25 +904,35 @@ func (g *GithubCache) cacheAssetFile(release *Release, asset *Asset) error {
 	}
 
 	tempPath := g.AssetFilePath(release, fmt.Sprintf("%s.tmp", asset.Name))
-	finalURL := strings.Replace(asset.URL, "https://api.github.com/", fmt.Sprintf("https://%s@api.github.com/", g.conf.Token), 1)
-	log.Info().Str("url", finalURL).Str("to", assetPath).Str("name", asset.Name).Str("size", fmt.Sprintf("%dM", asset.Size)).Msg("Downloading...")
+	log.Info().Str("url", asset.URL).Str("to", assetPath).Str("name", asset.Name).Str("size", fmt.Sprintf("%dM", asset.Size)).Msg("Downloading...")
 
 	var b io.Reader
 	if os.Getenv("MODE") == "TESTING" {
 		b = bytes.NewBuffer([]byte(""))
 	} else {
-		client := http.Client{}
-		req, err := http.NewRequest("GET", finalURL, nil)
+		client := g.httpClient
+		req, err := http.NewRequestWithContext(ctx, "GET", asset.URL, nil)
 		if err != nil {
 			return err
 		}
 		req.Header.Set("Accept", "application/octet-stream")
+		// The header is dropped when it's redirected to the storage host.
+		if g.conf.HasToken() {
+			token, err := g.tokens.resolve()
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Authorization", "token "+token)
+		}
 
 		resp, err := client.Do(req)
 		if err != nil {
 			return err
 		}
 		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("download %s: %s", asset.Name, resp.Status)
+		}
 		b = resp.Body
 	}
 
@@ -449,13 +962,18 @@ func (g *GithubCache) fetchAssetContent(ctx context.Context, id int64, url strin
 		return "", err
 	}
 	if redirectURL != "" {
-		resp, err := http.Get(redirectURL)
+		req, err := http.NewRequestWithContext(ctx, "GET", redirectURL, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := g.httpClient.Do(req)
 		if err != nil {
 			return "", err
 		}
 		rc = resp.Body
 	}
-	log.Debug().Str("redirectURL", redirectURL).Msg("Fetch asset content")
+	// The query of redirect url is a temporary credential.
+	log.Debug().Str("redirectURL", strings.SplitN(redirectURL, "?", 2)[0]).Msg("Fetch asset content")
 	defer rc.Close()
 
 	bs, err := ioutil.ReadAll(rc)
@@ -493,25 +1011,161 @@ func (g *GithubCache) fetchFileLatestYml(ctx context.Context, id int64, url stri
 	return content, nil
 }
 
-func (g *GithubCache) isOutdated() bool {
-	return time.Now().After(g.latestUpdate.Add(time.Minute * 3))
+// Refresh triggers refreshing from github as soon as possible, also of the apps sharing the repo,
+// it doesn't wait for the refresh. It's ignored in offline mode.
+func (g *GithubCache) Refresh() {
+	if g.scheduler != nil {
+		g.scheduler.Trigger()
+	}
+	g.mu.Lock()
+	apps := g.apps
+	g.mu.Unlock()
+	for _, app := range apps {
+		app.Refresh()
+	}
 }
 
-func (g *GithubCache) runRefreshLoop() {
-	defer g.wg.Done()
-	for {
-		if g.isOutdated() {
-			if err := g.refreshCache(); err != nil {
-				log.Error().Err(err).Msg("Refresh cache")
-			}
-		}
+// RefreshState returns the state of scheduled refreshes, nil in offline mode.
+func (g *GithubCache) RefreshState() *SchedulerState {
+	if g.scheduler == nil {
+		return nil
+	}
+	state := g.scheduler.State()
+	return &state
+}
 
-		select {
-		case <-g.quitCh:
-			return
-		case <-time.After(time.Minute * 1):
+// AddRefreshHook adds the hook called after release history is changed,
+// it's also called in background at once if there is history loaded.
+func (g *GithubCache) AddRefreshHook(hook RefreshHook) {
+	g.hooksMu.Lock()
+	g.hooks = append(g.hooks, hook)
+	g.hooksMu.Unlock()
+
+	if history := g.LoadReleases(); len(history) > 0 {
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			hook(g.ctx, history)
+		}()
+	}
+}
+
+func (g *GithubCache) runRefreshHooks(ctx context.Context, history []*Release) {
+	g.hooksMu.Lock()
+	hooks := g.hooks
+	g.hooksMu.Unlock()
+	for _, hook := range hooks {
+		hook(ctx, history)
+	}
+}
+
+// LoadReleases gets all releases in history, the latest is the first.
+func (g *GithubCache) LoadReleases() []*Release {
+	g.latestMu.RLock()
+	history := g.history
+	g.latestMu.RUnlock()
+	return history
+}
+
+// PlatformTargets returns all platforms which assets can be classified to.
+func (g *GithubCache) PlatformTargets() []string {
+	return g.classifier.Targets()
+}
+
+// IsBlocked checks if the version is blocked for serving.
+func (g *GithubCache) IsBlocked(version string) bool {
+	_, ok := g.blocked[canonicalVersion(version)]
+	return ok
+}
+
+// FindRelease finds the release of specific version in history.
+func (g *GithubCache) FindRelease(version string) (*Release, error) {
+	if g.IsBlocked(version) {
+		return nil, ErrReleaseBlocked
+	}
+	release := findRelease(g.LoadReleases(), version)
+	if release == nil {
+		return nil, ErrReleaseNotFound
+	}
+	return release, nil
+}
+
+// FillAsset makes sure the asset of the release is cached in proxy mode,
+// downloading is canceled when ctx is done.
+func (g *GithubCache) FillAsset(ctx context.Context, release *Release, asset *Asset) error {
+	return g.fillAsset(ctx, release, asset)
+}
+
+func (g *GithubCache) fillAsset(ctx context.Context, release *Release, asset *Asset) error {
+	unlock := g.lockAsset(g.AssetFilePath(release, asset.Name))
+	defer unlock()
+	return g.cacheAssetFile(ctx, release, asset)
+}
+
+// fillLock serializes fills of one asset file.
+type fillLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockAsset locks the asset file of path, fills of other files go on meanwhile.
+// It returns the function unlocking it.
+func (g *GithubCache) lockAsset(path string) func() {
+	g.fillMu.Lock()
+	l, ok := g.fills[path]
+	if !ok {
+		l = &fillLock{}
+		g.fills[path] = l
+	}
+	l.refs++
+	g.fillMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		g.fillMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(g.fills, path)
 		}
+		g.fillMu.Unlock()
+	}
+}
+
+// AssetSHA256 returns sha256 of the cached asset file, which is filled if it's not cached.
+func (g *GithubCache) AssetSHA256(ctx context.Context, release *Release, asset *Asset) (string, error) {
+	assetPath := g.AssetFilePath(release, asset.Name)
+	unlock := g.lockAsset(assetPath)
+	defer unlock()
+	g.fillMu.Lock()
+	sum, ok := g.sums[assetPath]
+	g.fillMu.Unlock()
+	if ok {
+		return sum, nil
+	}
+	if err := g.cacheAssetFile(ctx, release, asset); err != nil {
+		return "", err
 	}
+
+	f, err := os.Open(assetPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+	g.fillMu.Lock()
+	g.sums[assetPath] = sum
+	g.fillMu.Unlock()
+	return sum, nil
+}
+
+// RateLimit returns the github api rate limit state.
+func (g *GithubCache) RateLimit() RateLimit {
+	return g.api.loadRateLimit()
 }
 
 // LoadCache gets latest asset info.
@@ -1,7 +1,13 @@
 package cache
 
 import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 )
 
 var content = `version: 1.0.0
@@ -21,3 +27,264 @@ func TestLatestYml_ReplaceURL(t *testing.T) {
 	yml.ReplaceURL("http://crownote.com:8400/assets/panjiang/crownote/v1.0.1/Crownote-Setup-1.0.1.exe")
 	t.Log(yml.Content)
 }
+
+func TestClassifier_Classify(t *testing.T) {
+	tests := map[string]string{
+		"AtomSetup.exe":                     "exe",
+		"atom-mac.zip":                      "darwin",
+		"atom.dmg":                          "dmg",
+		"atom-amd64.deb":                    "deb",
+		"atom_1.52.0_arm64.deb":             "deb-arm64",
+		"atom-1.52.0.aarch64.rpm":           "rpm-arm64",
+		"Atom-1.52.0-armv7l.AppImage":       "AppImage-armv7l",
+		"atom-windows.zip":                  "win-zip",
+		"latest-linux-arm64.yml":            "",
+		"atom-1.52.0-x86_64.AppImage":       "AppImage",
+		"atom-api-1.52.0-full.nupkg":        "",
+		"atom-1.52.0-linux-armhf.tar.gz":    "tar.gz-armv7l",
+		"atom-1.52.0-linux-x64.tar.gz":      "tar.gz",
+		"atom-1.52.0-linux-arm64.zip":       "linux-zip-arm64",
+		"Atom-1.52.0.msi":                   "msi",
+		"Atom-1.52.0.msixbundle":            "msix",
+		"Atom-1.52.0.appx":                  "appx",
+		"Atom-1.52.0.pkg":                   "pkg",
+		"atom_1.52.0_amd64.snap":            "snap",
+		"atom_1.52.0_arm64.snap":            "snap-arm64",
+		"Atom.app.tar.gz":                   "darwin",
+		"App-Darwin.zip":                    "darwin",
+		"App-MacOS-arm64.zip":               "darwin",
+		"App-Win64.ZIP":                     "win-zip",
+		"App-Setup.EXE":                     "exe",
+		"App-Linux-ARM64.zip":               "linux-zip-arm64",
+		"App_1.0.0_x64_en-US.msi.zip":       "msi.zip",
+		"App_1.0.0_x64-setup.nsis.zip":      "nsis.zip",
+		"app_1.0.0_amd64.AppImage.tar.gz":   "AppImage.tar.gz",
+		"app_1.0.0_aarch64.AppImage.tar.gz": "AppImage.tar.gz-arm64",
+	}
+	classifier, err := NewClassifier(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for filename, platform := range tests {
+		if got := classifier.Classify(filename); got != platform {
+			t.Errorf("%s: expected platform is %q, got %q", filename, platform, got)
+		}
+	}
+
+	if got := checkLatestYmlPlatform("latest-linux-arm64.yml"); got != "AppImage-arm64" {
+		t.Errorf("Expected yml platform is AppImage-arm64, got %q", got)
+	}
+}
+
+func TestClassifier_CustomRules(t *testing.T) {
+	classifier, err := NewClassifier([]PlatformRule{
+		{Pattern: `-portable\.exe$`, Target: "win-portable"},
+		{Pattern: `\.msi$`, Target: "win-msi"},
+		{Pattern: `\.pkg$`, Target: "mac-pkg"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"App-Setup-1.0.exe":    "exe",
+		"App-1.0-portable.exe": "win-portable",
+		"App-1.0.msi":          "win-msi",
+		"App-1.0.pkg":          "mac-pkg",
+		"App-1.0.dmg":          "dmg",
+	}
+	for filename, platform := range tests {
+		if got := classifier.Classify(filename); got != platform {
+			t.Errorf("%s: expected platform is %q, got %q", filename, platform, got)
+		}
+	}
+
+	if _, err := NewClassifier([]PlatformRule{{Pattern: "(", Target: "x"}}); err == nil {
+		t.Error("Expected error of invalid pattern")
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	notes := "---\nminimumSystemVersion: \"10.13\"\nsignatures:\n  App-mac.zip: c2lnbmF0dXJl\n---\n\n## Changes\n"
+	meta, text := parseFrontMatter(notes)
+	if meta == nil {
+		t.Fatal("Expected front matter")
+	}
+	if meta.MinimumSystemVersion != "10.13" {
+		t.Errorf("Expected minimumSystemVersion is 10.13, got %q", meta.MinimumSystemVersion)
+	}
+	if sig := meta.Signatures["App-mac.zip"]; sig != "c2lnbmF0dXJl" {
+		t.Errorf("Expected signature is c2lnbmF0dXJl, got %q", sig)
+	}
+	if text != "## Changes\n" {
+		t.Errorf("Expected notes without front matter, got %q", text)
+	}
+
+	if meta, text := parseFrontMatter("## Changes\n---\n"); meta != nil || text != "## Changes\n---\n" {
+		t.Errorf("Expected no front matter, got %v %q", meta, text)
+	}
+}
+
+func TestRelease_Channel(t *testing.T) {
+	tests := []struct {
+		release *Release
+		channel string
+	}{
+		{&Release{Version: "v1.2.0"}, StableChannel},
+		{&Release{Version: "1.2.0-beta.1"}, "beta"},
+		{&Release{Version: "v1.2.0", Meta: &ReleaseMeta{Channel: "nightly"}}, "nightly"},
+	}
+	for _, tt := range tests {
+		if got := tt.release.Channel(); got != tt.channel {
+			t.Errorf("%s: expected channel is %q, got %q", tt.release.Version, tt.channel, got)
+		}
+	}
+}
+
+func TestGithubCache_FillBlockmaps(t *testing.T) {
+	os.Setenv("MODE", "TESTING")
+	dir, err := ioutil.TempDir("", "gohazel-blockmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	g := NewGithubCache(&GithubConfig{Owner: "panjiang", Repo: "gohazel-testing"}, &Options{
+		CacheDir:      dir,
+		ProxyDownload: true,
+		CacheURLBase:  "http://localhost:8400/assets",
+	})
+	defer g.Stop()
+
+	exe := &Asset{Name: "App-Setup-1.0.0.exe", Blockmap: &Asset{Name: "App-Setup-1.0.0.exe.blockmap"}}
+	release := &Release{Version: "v1.0.0", Platforms: map[string]*Asset{"exe": exe}}
+	g.fillBlockmaps(context.Background(), release)
+
+	if _, err := os.Stat(g.AssetFilePath(release, exe.Blockmap.Name)); err != nil {
+		t.Errorf("Blockmap is not cached: %v", err)
+	}
+	// electron-updater requests the blockmap next to the installer url in latest yml.
+	if got := g.AssetFileURL(release, exe.Blockmap.Name); got != g.AssetFileURL(release, exe.Name)+".blockmap" {
+		t.Errorf("Unexpected blockmap url %s", got)
+	}
+}
+
+func TestGithubCache_FillAsset(t *testing.T) {
+	mode := os.Getenv("MODE")
+	os.Unsetenv("MODE")
+	defer os.Setenv("MODE", mode)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/App-1.0.0.dmg" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("dmg"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "gohazel-fill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	g := NewGithubCache(&GithubConfig{Owner: "panjiang", Repo: "gohazel-testing"}, &Options{CacheDir: dir, ProxyDownload: true})
+	defer g.Stop()
+	release := &Release{Version: "v1.0.0"}
+
+	// Error pages are not cached as assets.
+	missing := &Asset{Name: "App-1.0.0.exe", URL: srv.URL + "/App-1.0.0.exe"}
+	if err := g.FillAsset(context.Background(), release, missing); err == nil {
+		t.Error("expected error of not found asset")
+	}
+	if _, err := os.Stat(g.AssetFilePath(release, missing.Name)); !os.IsNotExist(err) {
+		t.Errorf("expected no cached file of not found asset, got %v", err)
+	}
+
+	dmg := &Asset{Name: "App-1.0.0.dmg", URL: srv.URL + "/App-1.0.0.dmg"}
+	sum, err := g.AssetSHA256(context.Background(), release, dmg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != "00cbbd0ddbda2762798f7009838ed34ca1f12b93965813c7df22943bc62166d1" {
+		t.Errorf("unexpected sha256 %s", sum)
+	}
+}
+
+func TestGithubCache_FillAsset_EnvToken(t *testing.T) {
+	mode := os.Getenv("MODE")
+	os.Unsetenv("MODE")
+	defer os.Setenv("MODE", mode)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token env-token" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("dmg"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "gohazel-fill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A private repo with the token only from environment.
+	g := NewGithubCache(&GithubConfig{Owner: "panjiang", Repo: "gohazel-testing", EnvToken: "env-token"}, &Options{CacheDir: dir, ProxyDownload: true})
+	defer g.Stop()
+	asset := &Asset{Name: "App-1.0.0.dmg", URL: srv.URL + "/App-1.0.0.dmg"}
+	if err := g.FillAsset(context.Background(), &Release{Version: "v1.0.0"}, asset); err != nil {
+		t.Errorf("expected the asset is downloaded with the env token, got %v", err)
+	}
+}
+
+func TestGithubCache_FillAsset_Concurrent(t *testing.T) {
+	mode := os.Getenv("MODE")
+	os.Unsetenv("MODE")
+	defer os.Setenv("MODE", mode)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/App-0.9.0.dmg" {
+			close(started)
+			<-release
+		}
+		w.Write([]byte("dmg"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "gohazel-fill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	g := NewGithubCache(&GithubConfig{Owner: "panjiang", Repo: "gohazel-testing"}, &Options{CacheDir: dir, ProxyDownload: true})
+	defer g.Stop()
+
+	// A slow fill of an old release doesn't block fills of other assets.
+	slow := make(chan error, 1)
+	go func() {
+		slow <- g.FillAsset(context.Background(), &Release{Version: "v0.9.0"}, &Asset{Name: "App-0.9.0.dmg", URL: srv.URL + "/App-0.9.0.dmg"})
+	}()
+	<-started
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.AssetSHA256(context.Background(), &Release{Version: "v1.0.0"}, &Asset{Name: "App-1.0.0.dmg", URL: srv.URL + "/App-1.0.0.dmg"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("fill is blocked by the fill of another asset")
+	}
+
+	close(release)
+	if err := <-slow; err != nil {
+		t.Error(err)
+	}
+}
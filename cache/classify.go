@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// PlatformRule classifies assets whose name matches the pattern to the target platform.
+type PlatformRule struct {
+	Pattern string `yaml:"pattern"`
+	Target  string `yaml:"target"`
+}
+
+// DefaultPlatformRules classify assets by extension case-insensitively,
+// with arch suffix for ARM Linux packages. Tauri v1 updater archives are checked
+// first, and rules of darwin before the one of `win` in names, which is also in `darwin`.
+var DefaultPlatformRules = []PlatformRule{
+	{Pattern: `(?i)\.msi\.zip$`, Target: "msi.zip"},
+	{Pattern: `(?i)\.nsis\.zip$`, Target: "nsis.zip"},
+	{Pattern: `(?i)(arm64|aarch64).*\.AppImage\.tar\.gz$`, Target: "AppImage.tar.gz-arm64"},
+	{Pattern: `(?i)(armv7l|armhf).*\.AppImage\.tar\.gz$`, Target: "AppImage.tar.gz-armv7l"},
+	{Pattern: `(?i)\.AppImage\.tar\.gz$`, Target: "AppImage.tar.gz"},
+	{Pattern: `(?i)(mac|darwin).*\.zip$`, Target: "darwin"},
+	{Pattern: `(?i)\.darwin$`, Target: "darwin"},
+	{Pattern: `(?i)\.app\.tar\.gz$`, Target: "darwin"},
+	{Pattern: `(?i)win.*\.zip$`, Target: "win-zip"},
+	{Pattern: `(?i)((arm64|aarch64).*linux|linux.*(arm64|aarch64)).*\.zip$`, Target: "linux-zip-arm64"},
+	{Pattern: `(?i)((armv7l|armhf).*linux|linux.*(armv7l|armhf)).*\.zip$`, Target: "linux-zip-armv7l"},
+	{Pattern: `(?i)linux.*\.zip$`, Target: "linux-zip"},
+	{Pattern: `(?i)\.exe$`, Target: "exe"},
+	{Pattern: `(?i)\.msi$`, Target: "msi"},
+	{Pattern: `(?i)\.msix(bundle)?$`, Target: "msix"},
+	{Pattern: `(?i)\.appx(bundle)?$`, Target: "appx"},
+	{Pattern: `(?i)\.dmg$`, Target: "dmg"},
+	{Pattern: `(?i)\.pkg$`, Target: "pkg"},
+	{Pattern: `(?i)(arm64|aarch64).*\.rpm$`, Target: "rpm-arm64"},
+	{Pattern: `(?i)(armv7l|armhf).*\.rpm$`, Target: "rpm-armv7l"},
+	{Pattern: `(?i)\.rpm$`, Target: "rpm"},
+	{Pattern: `(?i)(arm64|aarch64).*\.deb$`, Target: "deb-arm64"},
+	{Pattern: `(?i)(armv7l|armhf).*\.deb$`, Target: "deb-armv7l"},
+	{Pattern: `(?i)\.deb$`, Target: "deb"},
+	{Pattern: `(?i)(arm64|aarch64).*\.AppImage$`, Target: "AppImage-arm64"},
+	{Pattern: `(?i)(armv7l|armhf).*\.AppImage$`, Target: "AppImage-armv7l"},
+	{Pattern: `(?i)\.AppImage$`, Target: "AppImage"},
+	{Pattern: `(?i)(arm64|aarch64).*\.snap$`, Target: "snap-arm64"},
+	{Pattern: `(?i)(armv7l|armhf).*\.snap$`, Target: "snap-armv7l"},
+	{Pattern: `(?i)\.snap$`, Target: "snap"},
+	{Pattern: `(?i)(arm64|aarch64).*\.tar\.gz$`, Target: "tar.gz-arm64"},
+	{Pattern: `(?i)(armv7l|armhf).*\.tar\.gz$`, Target: "tar.gz-armv7l"},
+	{Pattern: `(?i)\.tar\.gz$`, Target: "tar.gz"},
+}
+
+type classifyRule struct {
+	re     *regexp.Regexp
+	target string
+}
+
+// Classifier maps asset names to platforms, the first matched rule wins.
+type Classifier struct {
+	rules []*classifyRule
+}
+
+// NewClassifier compiles the rules, which are checked before the default rules.
+func NewClassifier(rules []PlatformRule) (*Classifier, error) {
+	c := &Classifier{}
+	for _, rule := range append(rules, DefaultPlatformRules...) {
+		if rule.Target == "" {
+			return nil, fmt.Errorf("platform rule %q has no target", rule.Pattern)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("platform rule %q: %w", rule.Pattern, err)
+		}
+		c.rules = append(c.rules, &classifyRule{re: re, target: rule.Target})
+	}
+	return c, nil
+}
+
+// Classify returns the platform of asset, or empty string if no rule matches.
+func (c *Classifier) Classify(filename string) string {
+	for _, rule := range c.rules {
+		if rule.re.MatchString(filename) {
+			return rule.target
+		}
+	}
+	return ""
+}
+
+// Targets returns all platforms the rules can classify to.
+func (c *Classifier) Targets() []string {
+	var targets []string
+	seen := make(map[string]struct{})
+	for _, rule := range c.rules {
+		if _, ok := seen[rule.target]; ok {
+			continue
+		}
+		seen[rule.target] = struct{}{}
+		targets = append(targets, rule.target)
+	}
+	return targets
+}
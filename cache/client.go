@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIBaseURL returns the base url of github api, with trailing slash.
+// The enterprise one is suffixed with `api/v3/` as the github client does.
+func (c *GithubConfig) APIBaseURL() string {
+	if c.APIURL == "" {
+		return defaultAPIURL
+	}
+	return enterpriseURL(c.APIURL, "/api/v3/")
+}
+
+// UploadBaseURL returns the base url of uploading.
+func (c *GithubConfig) UploadBaseURL() string {
+	if c.UploadURL != "" {
+		return enterpriseURL(c.UploadURL, "/api/uploads/")
+	}
+	if c.APIURL != "" {
+		return enterpriseURL(strings.TrimSuffix(c.APIBaseURL(), "api/v3/"), "/api/uploads/")
+	}
+	return "https://uploads.github.com/"
+}
+
+func enterpriseURL(u string, suffix string) string {
+	u = strings.TrimSuffix(u, "/") + "/"
+	if !strings.HasSuffix(u, suffix) {
+		u += strings.TrimPrefix(suffix, "/")
+	}
+	return u
+}
+
+// Host returns the host of github web, e.g. `github.com`.
+func (c *GithubConfig) Host() string {
+	if c.APIURL == "" {
+		return "github.com"
+	}
+	u, err := url.Parse(c.APIURL)
+	if err != nil || u.Host == "" {
+		return "github.com"
+	}
+	return strings.TrimPrefix(u.Host, "api.")
+}
+
+// HTTPClient returns the client for requests to github and asset downloads,
+// with the configured proxy and CA bundle.
+func (c *GithubConfig) HTTPClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if c.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate in %s", c.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: transport}, nil
+}
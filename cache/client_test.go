@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGithubConfig_URLs(t *testing.T) {
+	tests := []struct {
+		apiURL    string
+		uploadURL string
+		api       string
+		upload    string
+		repo      string
+	}{
+		{"", "", "https://api.github.com/", "https://uploads.github.com/", "github.com/atom/atom"},
+		{"https://github.example.com/api/v3", "", "https://github.example.com/api/v3/", "https://github.example.com/api/uploads/", "github.example.com/atom/atom"},
+		{"https://github.example.com/", "https://uploads.example.com/", "https://github.example.com/api/v3/", "https://uploads.example.com/api/uploads/", "github.example.com/atom/atom"},
+	}
+	for _, tt := range tests {
+		conf := &GithubConfig{Owner: "atom", Repo: "atom", APIURL: tt.apiURL, UploadURL: tt.uploadURL}
+		if got := conf.APIBaseURL(); got != tt.api {
+			t.Errorf("%s: expected api url is %s, got %s", tt.apiURL, tt.api, got)
+		}
+		if got := conf.UploadBaseURL(); got != tt.upload {
+			t.Errorf("%s: expected upload url is %s, got %s", tt.apiURL, tt.upload, got)
+		}
+		if got := conf.RepoURL(); got != tt.repo {
+			t.Errorf("%s: expected repo url is %s, got %s", tt.apiURL, tt.repo, got)
+		}
+	}
+}
+
+func TestGithubCache_NewClient_Enterprise(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/repos/atom/atom/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer enterprise-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`[{"tag_name": "v1.0.0"}]`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "gohazel-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &GithubConfig{Owner: "atom", Repo: "atom", Token: "enterprise-token", APIURL: srv.URL, CAFile: caFile}
+	g := NewGithubCache(conf, &Options{CacheDir: dir, Offline: true})
+	defer g.Stop()
+
+	ctx := context.Background()
+	releases, _, err := g.newClient(ctx).Repositories.ListReleases(ctx, "atom", "atom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 1 || releases[0].GetTagName() != "v1.0.0" {
+		t.Errorf("unexpected releases: %v", releases)
+	}
+
+	// Untrusted without the CA bundle.
+	conf.CAFile = ""
+	g = NewGithubCache(conf, &Options{CacheDir: dir, Offline: true})
+	defer g.Stop()
+	if _, _, err := g.newClient(ctx).Repositories.ListReleases(ctx, "atom", "atom", nil); err == nil {
+		t.Error("expected error of unknown certificate authority")
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ReleaseFilter selects releases and assets of one app in a repo shared by multiple apps,
+// e.g. a monorepo tagging `desktop-v2.3.0` and `cli-v1.1.0`.
+type ReleaseFilter struct {
+	// TagPrefix is required on tags, and trimmed for versions, e.g. `desktop-`.
+	TagPrefix string `yaml:"tagPrefix"`
+	// TagPattern is matched against whole tags, the version is its `version` group
+	// or the first group, e.g. `^desktop-(v[0-9.]+)$`.
+	TagPattern string `yaml:"tagPattern"`
+	// IncludeAssets are patterns of asset names to serve, all assets by default.
+	IncludeAssets []string `yaml:"includeAssets"`
+	// ExcludeAssets are patterns of asset names not to serve.
+	ExcludeAssets []string `yaml:"excludeAssets"`
+}
+
+// Filter matches tags and asset names by the compiled release filter.
+type Filter struct {
+	prefix  string
+	pattern *regexp.Regexp
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewFilter compiles the release filter.
+func NewFilter(conf *ReleaseFilter) (*Filter, error) {
+	f := &Filter{prefix: conf.TagPrefix}
+	if conf.TagPattern != "" {
+		re, err := regexp.Compile(conf.TagPattern)
+		if err != nil {
+			return nil, fmt.Errorf("tag pattern %q: %w", conf.TagPattern, err)
+		}
+		f.pattern = re
+	}
+	var err error
+	if f.include, err = compilePatterns(conf.IncludeAssets); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compilePatterns(conf.ExcludeAssets); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("asset pattern %q: %w", pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Version extracts the version from tag, false if the tag is not of the app.
+func (f *Filter) Version(tag string) (string, bool) {
+	if !strings.HasPrefix(tag, f.prefix) {
+		return "", false
+	}
+	version := strings.TrimPrefix(tag, f.prefix)
+	if f.pattern == nil {
+		return version, true
+	}
+
+	matches := f.pattern.FindStringSubmatch(tag)
+	if matches == nil {
+		return "", false
+	}
+	for i, name := range f.pattern.SubexpNames() {
+		if name == "version" {
+			return matches[i], matches[i] != ""
+		}
+	}
+	if len(matches) > 1 {
+		return matches[1], matches[1] != ""
+	}
+	return version, true
+}
+
+// MatchAsset reports whether the asset is served.
+func (f *Filter) MatchAsset(name string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package cache
+
+import "testing"
+
+func TestFilter_Version(t *testing.T) {
+	tests := []struct {
+		filter  ReleaseFilter
+		tag     string
+		version string
+		ok      bool
+	}{
+		{ReleaseFilter{}, "v1.0.0", "v1.0.0", true},
+		{ReleaseFilter{TagPrefix: "desktop-"}, "desktop-v2.3.0", "v2.3.0", true},
+		{ReleaseFilter{TagPrefix: "desktop-"}, "cli-v1.1.0", "", false},
+		{ReleaseFilter{TagPattern: `^desktop-(v[0-9.]+)$`}, "desktop-v2.3.0", "v2.3.0", true},
+		{ReleaseFilter{TagPattern: `^desktop-(v[0-9.]+)$`}, "desktop-v2.3.0-beta.1", "", false},
+		{ReleaseFilter{TagPattern: `^(?P<app>\w+)@(?P<version>.+)$`}, "cli@1.1.0", "1.1.0", true},
+		{ReleaseFilter{TagPattern: `^release-`}, "release-1.0.0", "release-1.0.0", true},
+		{ReleaseFilter{TagPrefix: "cli-", TagPattern: `-v1\.`}, "cli-v1.1.0", "v1.1.0", true},
+		{ReleaseFilter{TagPrefix: "cli-", TagPattern: `-v1\.`}, "cli-v2.0.0", "", false},
+	}
+	for _, tt := range tests {
+		f, err := NewFilter(&tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		version, ok := f.Version(tt.tag)
+		if version != tt.version || ok != tt.ok {
+			t.Errorf("%+v %s: expected %q %v, got %q %v", tt.filter, tt.tag, tt.version, tt.ok, version, ok)
+		}
+	}
+}
+
+func TestFilter_MatchAsset(t *testing.T) {
+	f, err := NewFilter(&ReleaseFilter{
+		IncludeAssets: []string{`^Desktop-`, `^latest.*\.yml$`},
+		ExcludeAssets: []string{`\.sha256$`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"Desktop-Setup-2.3.0.exe":        true,
+		"Desktop-Setup-2.3.0.exe.sha256": false,
+		"latest-mac.yml":                 true,
+		"cli-linux-amd64.tar.gz":         false,
+	}
+	for name, expected := range tests {
+		if got := f.MatchAsset(name); got != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, got)
+		}
+	}
+
+	if _, err := NewFilter(&ReleaseFilter{ExcludeAssets: []string{"("}}); err == nil {
+		t.Error("expected error of invalid pattern")
+	}
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Pins of the update policy, which keep clients in their major or minor line.
+const (
+	PinMajor = "major"
+	PinMinor = "minor"
+)
+
+// Line is a release line, e.g. the major version kept for enterprise customers.
+type Line struct {
+	Name string `yaml:"name" json:"name"`
+	// Version is the major or minor version of releases in the line, e.g. `v3` or `v3.4`.
+	Version string `yaml:"version" json:"version"`
+}
+
+// Validate checks the version of the line.
+func (l *Line) Validate() error {
+	v := l.version()
+	if l.Name == "" || !semver.IsValid(v) || (v != semver.Major(v) && v != semver.MajorMinor(v)) {
+		return fmt.Errorf("invalid line %q of version %q", l.Name, l.Version)
+	}
+	return nil
+}
+
+func (l *Line) version() string {
+	return "v" + strings.TrimPrefix(l.Version, "v")
+}
+
+// Contains reports whether the version is in the line.
+func (l *Line) Contains(version string) bool {
+	v := canonicalVersion(version)
+	return semver.Major(v) == l.version() || semver.MajorMinor(v) == l.version()
+}
+
+// UpdatePolicy keeps clients in their release line, unless they opt in to a major upgrade.
+type UpdatePolicy struct {
+	// Pin keeps clients out of the defined lines in their `major` or `minor` line,
+	// they are updated to the latest release by default.
+	Pin   string `yaml:"pin"`
+	Lines []Line `yaml:"lines"`
+	// SteppingStones are offered to clients below them instead of newer releases.
+	SteppingStones []SteppingStone `yaml:"steppingStones"`
+}
+
+// Validate checks the pin and lines.
+func (p *UpdatePolicy) Validate() error {
+	switch p.Pin {
+	case "", PinMajor, PinMinor:
+	default:
+		return fmt.Errorf("unknown update pin: %s", p.Pin)
+	}
+	for i := range p.Lines {
+		if err := p.Lines[i].Validate(); err != nil {
+			return err
+		}
+	}
+	for i := range p.SteppingStones {
+		if err := p.SteppingStones[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LineOf returns the line of the client version, the first defined line containing it,
+// or the major or minor line by the pin. It's nil if the client is not kept in a line.
+func (p *UpdatePolicy) LineOf(version string) *Line {
+	for i := range p.Lines {
+		if p.Lines[i].Contains(version) {
+			return &p.Lines[i]
+		}
+	}
+	v := canonicalVersion(version)
+	if !semver.IsValid(v) {
+		return nil
+	}
+	switch p.Pin {
+	case PinMajor:
+		return &Line{Name: semver.Major(v), Version: semver.Major(v)}
+	case PinMinor:
+		return &Line{Name: semver.MajorMinor(v), Version: semver.MajorMinor(v)}
+	}
+	return nil
+}
+
+// latestOf returns the latest release of the line in history ordered by semver, nil if there is none.
+func latestOf(history []*Release, line *Line) *Release {
+	var releases []*Release
+	for _, release := range history {
+		if line.Contains(release.Version) {
+			releases = append(releases, release)
+		}
+	}
+	if len(releases) == 0 {
+		return nil
+	}
+	return latestRelease(releases)
+}
+
+// LatestOf returns the latest release of the line, nil if there is none in history.
+func (g *GithubCache) LatestOf(line *Line) *Release {
+	return latestOf(g.LoadReleases(), line)
+}
+
+// NextLineLatest returns the latest release of the lowest line newer than the version,
+// for clients whose own line has no release in history. It's nil if there is no newer stable release.
+func (g *GithubCache) NextLineLatest(policy *UpdatePolicy, version string) *Release {
+	history := g.LoadReleases()
+	// History is ordered from the highest.
+	for i := len(history) - 1; i >= 0; i-- {
+		release := history[i]
+		if release.Channel() != StableChannel || compareVersions(release.Version, version) <= 0 {
+			continue
+		}
+		if line := policy.LineOf(release.Version); line != nil {
+			return latestOf(history, line)
+		}
+		return g.LoadCache()
+	}
+	return nil
+}
+
+// trimHistory keeps the latest releases in history ordered by semver,
+// and the latest one of each defined line and the stepping stones besides them.
+func (g *GithubCache) trimHistory(history []*Release) []*Release {
+	kept := make(map[*Release]bool)
+	for i, release := range history {
+		if i < g.keepReleases {
+			kept[release] = true
+		}
+	}
+	for i := range g.lines {
+		if release := latestOf(history, &g.lines[i]); release != nil {
+			kept[release] = true
+		}
+	}
+	for _, stone := range g.stones {
+		if release := findRelease(history, stone.Version); release != nil {
+			kept[release] = true
+		}
+	}
+	var trimmed []*Release
+	for _, release := range history {
+		if kept[release] {
+			trimmed = append(trimmed, release)
+		}
+	}
+	return trimmed
+}
+
+// hasKept reports whether there are releases of all defined lines and stepping stones.
+func (g *GithubCache) hasKept(history []*Release) bool {
+	for i := range g.lines {
+		if latestOf(history, &g.lines[i]) == nil {
+			return false
+		}
+	}
+	for _, stone := range g.stones {
+		if findRelease(history, stone.Version) == nil {
+			return false
+		}
+	}
+	return true
+}
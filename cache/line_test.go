@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUpdatePolicy_LineOf(t *testing.T) {
+	lines := []Line{{Name: "lts", Version: "v3"}, {Name: "legacy", Version: "2.9"}}
+	tests := []struct {
+		pin     string
+		version string
+		line    string
+	}{
+		{"", "v3.4.1", "lts"},
+		{"", "3.0.0", "lts"},
+		{"", "v2.9.5", "legacy"},
+		{"", "v2.8.0", ""},
+		{"", "v4.0.0", ""},
+		{PinMajor, "v4.1.0", "v4"},
+		{PinMajor, "v3.1.0", "lts"},
+		{PinMinor, "v4.1.2", "v4.1"},
+		{PinMinor, "invalid", ""},
+	}
+	for _, tt := range tests {
+		p := &UpdatePolicy{Pin: tt.pin, Lines: lines}
+		line := p.LineOf(tt.version)
+		name := ""
+		if line != nil {
+			name = line.Name
+		}
+		if name != tt.line {
+			t.Errorf("%s %s: expected line is %q, got %q", tt.pin, tt.version, tt.line, name)
+		}
+	}
+}
+
+func TestUpdatePolicy_Validate(t *testing.T) {
+	tests := []struct {
+		policy UpdatePolicy
+		valid  bool
+	}{
+		{UpdatePolicy{}, true},
+		{UpdatePolicy{Pin: PinMinor, Lines: []Line{{Name: "lts", Version: "3"}, {Name: "old", Version: "v2.9"}}}, true},
+		{UpdatePolicy{Pin: "patch"}, false},
+		{UpdatePolicy{Lines: []Line{{Name: "lts", Version: "v3.1.0"}}}, false},
+		{UpdatePolicy{Lines: []Line{{Name: "", Version: "v3"}}}, false},
+		{UpdatePolicy{Lines: []Line{{Name: "lts", Version: "x"}}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%+v: expected valid is %v, got %v", tt.policy, tt.valid, err)
+		}
+	}
+}
+
+func TestGithubCache_TrimHistory(t *testing.T) {
+	var history []*Release
+	for _, v := range []string{"v4.2.0", "v4.1.0", "v4.0.0", "v3.5.0-beta.1", "v3.4.1", "v3.4.0", "v2.9.0"} {
+		history = append(history, &Release{Version: v})
+	}
+	g := &GithubCache{keepReleases: 2, lines: []Line{{Name: "lts", Version: "v3"}, {Name: "old", Version: "v1"}}}
+	var versions []string
+	for _, release := range g.trimHistory(history) {
+		versions = append(versions, release.Version)
+	}
+	// The stable one of the line is kept.
+	if fmt.Sprint(versions) != "[v4.2.0 v4.1.0 v3.4.1]" {
+		t.Errorf("unexpected history: %v", versions)
+	}
+	if release := latestOf(history, &g.lines[0]); release == nil || release.Version != "v3.4.1" {
+		t.Errorf("unexpected latest of line: %v", release)
+	}
+}
+
+func TestGithubCache_NextLineLatest(t *testing.T) {
+	var history []*Release
+	for _, v := range []string{"v4.2.0", "v4.1.0", "v3.5.0-beta.1", "v3.4.1", "v3.4.0"} {
+		history = append(history, &Release{Version: v})
+	}
+	g := &GithubCache{history: history, latest: history[0]}
+	tests := []struct {
+		pin     string
+		version string
+		latest  string
+	}{
+		{PinMajor, "v2.0.0", "v3.4.1"},
+		{PinMajor, "v3.5.0", "v4.2.0"},
+		{PinMinor, "v3.3.0", "v3.4.1"},
+		{PinMinor, "v4.0.0", "v4.1.0"},
+		{PinMajor, "v4.3.0", ""},
+	}
+	for _, tt := range tests {
+		var latest string
+		if release := g.NextLineLatest(&UpdatePolicy{Pin: tt.pin}, tt.version); release != nil {
+			latest = release.Version
+		}
+		if latest != tt.latest {
+			t.Errorf("%s %s: expected %q, got %q", tt.pin, tt.version, tt.latest, latest)
+		}
+	}
+}
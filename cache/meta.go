@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"strings"
+
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v2"
+)
+
+// StableChannel is the channel of releases without prerelease version.
+const StableChannel = "stable"
+
+// ReleaseMeta is the front matter at the top of release notes, e.g.
+//
+//	---
+//	minimumSystemVersion: "10.13"
+//	signatures:
+//	  App-mac.zip: <EdDSA signature>
+//	---
+type ReleaseMeta struct {
+	Channel              string            `yaml:"channel" json:"channel,omitempty"`
+	MinimumSystemVersion string            `yaml:"minimumSystemVersion" json:"minimumSystemVersion,omitempty"`
+	Signatures           map[string]string `yaml:"signatures" json:"signatures,omitempty"`
+}
+
+// parseFrontMatter splits the front matter from release notes,
+// the notes are returned as it is if there is no valid front matter.
+func parseFrontMatter(notes string) (*ReleaseMeta, string) {
+	text := strings.ReplaceAll(notes, "\r\n", "\n")
+	if !strings.HasPrefix(text, "---\n") {
+		return nil, notes
+	}
+	end := strings.Index(text[4:], "\n---")
+	if end < 0 {
+		return nil, notes
+	}
+	rest := text[4+end+4:]
+	if rest != "" && rest[0] != '\n' {
+		return nil, notes
+	}
+
+	var meta ReleaseMeta
+	if err := yaml.Unmarshal([]byte(text[4:4+end]), &meta); err != nil {
+		return nil, notes
+	}
+	return &meta, strings.TrimLeft(rest, "\n")
+}
+
+// TagName of the release on github, which is the version unless the tag has a prefix.
+func (r *Release) TagName() string {
+	if r.Tag != "" {
+		return r.Tag
+	}
+	return r.Version
+}
+
+// Channel of the release, from the front matter or the prerelease identifier of version,
+// e.g. `v1.2.0-beta.1` is in channel `beta`.
+func (r *Release) Channel() string {
+	if r.Meta != nil && r.Meta.Channel != "" {
+		return r.Meta.Channel
+	}
+	prerelease := semver.Prerelease(canonicalVersion(r.Version))
+	if prerelease == "" {
+		return StableChannel
+	}
+	return strings.SplitN(prerelease[1:], ".", 2)[0]
+}
+
+// Signature returns the EdDSA signature of the asset,
+// from the sidecar `.sig` asset or the front matter.
+func (r *Release) Signature(asset *Asset) string {
+	if asset.Signature != "" {
+		return asset.Signature
+	}
+	if r.Meta != nil {
+		return r.Meta.Signatures[asset.Name]
+	}
+	return ""
+}
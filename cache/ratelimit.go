@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitReserve is the remaining requests kept, refreshing waits for the reset below it.
+const rateLimitReserve = 5
+
+// RateLimit is the github api rate limit state from response headers.
+type RateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	// RetryAfter is when requests are allowed again after hitting the secondary limit.
+	RetryAfter  time.Time `json:"retryAfter"`
+	Requests    int64     `json:"requests"`
+	NotModified int64     `json:"notModified"`
+}
+
+// Wait returns how long to wait before the next request, zero if it's allowed now.
+func (r RateLimit) Wait(now time.Time) time.Duration {
+	if now.Before(r.RetryAfter) {
+		return r.RetryAfter.Sub(now)
+	}
+	if r.Limit > 0 && r.Remaining < rateLimitReserve && now.Before(r.Reset) {
+		return r.Reset.Sub(now)
+	}
+	return 0
+}
+
+type etagEntry struct {
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+// apiTransport sends conditional requests with ETags of previous responses,
+// since 304 responses don't count against the rate limit, and records the rate limit.
+// Cached bodies are replayed for 304 responses, so callers see the normal ones.
+type apiTransport struct {
+	base      http.RoundTripper
+	mu        sync.Mutex
+	etags     map[string]*etagEntry
+	rateLimit RateLimit
+}
+
+func newAPITransport(base http.RoundTripper) *apiTransport {
+	return &apiTransport{base: base, etags: make(map[string]*etagEntry)}
+}
+
+func (t *apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+	var entry *etagEntry
+	if req.Method == http.MethodGet {
+		t.mu.Lock()
+		entry = t.etags[key]
+		t.mu.Unlock()
+	}
+	if entry != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.record(resp)
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		header := entry.header.Clone()
+		for _, k := range []string{"X-Ratelimit-Limit", "X-Ratelimit-Remaining", "X-Ratelimit-Reset"} {
+			if v := resp.Header.Get(k); v != "" {
+				header.Set(k, v)
+			}
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(entry.body)),
+			ContentLength: int64(len(entry.body)),
+			Request:       resp.Request,
+		}, nil
+	}
+
+	// Only api responses are kept, not asset contents.
+	etag := resp.Header.Get("ETag")
+	if req.Method != http.MethodGet || resp.StatusCode != http.StatusOK || etag == "" ||
+		!strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.mu.Lock()
+	t.etags[key] = &etagEntry{etag: etag, header: resp.Header.Clone(), body: body}
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// record updates the rate limit from response headers.
+func (t *apiTransport) record(resp *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rateLimit.Requests++
+	if resp.StatusCode == http.StatusNotModified {
+		t.rateLimit.NotModified++
+	}
+	if v, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		t.rateLimit.Limit = v
+	}
+	if v, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		t.rateLimit.Remaining = v
+	}
+	if v, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		t.rateLimit.Reset = time.Unix(v, 0)
+	}
+	// Secondary rate limit.
+	if v, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		t.rateLimit.RetryAfter = time.Now().Add(time.Duration(v) * time.Second)
+	}
+}
+
+// retryAfter blocks requests until the time, e.g. from an abuse rate limit error.
+func (t *apiTransport) retryAfter(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.After(t.rateLimit.RetryAfter) {
+		t.rateLimit.RetryAfter = at
+	}
+}
+
+func (t *apiTransport) loadRateLimit() RateLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rateLimit
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAPITransport(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	remaining := 60
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		remaining--
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`[{"tag_name": "v1.0.0"}]`))
+	}))
+	defer srv.Close()
+
+	transport := newAPITransport(http.DefaultTransport)
+	client := &http.Client{Transport: transport}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL + "/repos/atom/atom/releases")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(b) != `[{"tag_name": "v1.0.0"}]` {
+			t.Errorf("%d: unexpected response %d %s", i, resp.StatusCode, b)
+		}
+		if resp.Header.Get("X-RateLimit-Remaining") != "59" {
+			t.Errorf("%d: expected remaining is 59, got %s", i, resp.Header.Get("X-RateLimit-Remaining"))
+		}
+	}
+
+	rateLimit := transport.loadRateLimit()
+	if rateLimit.Limit != 60 || rateLimit.Remaining != 59 || rateLimit.Reset.Unix() != reset {
+		t.Errorf("unexpected rate limit: %+v", rateLimit)
+	}
+	if rateLimit.Requests != 3 || rateLimit.NotModified != 2 {
+		t.Errorf("expected 2 of 3 requests are not modified, got %+v", rateLimit)
+	}
+}
+
+func TestRateLimit_Wait(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		rateLimit RateLimit
+		wait      time.Duration
+	}{
+		{"unknown", RateLimit{}, 0},
+		{"remaining", RateLimit{Limit: 60, Remaining: 30, Reset: now.Add(time.Hour)}, 0},
+		{"exhausted", RateLimit{Limit: 60, Remaining: 2, Reset: now.Add(time.Hour)}, time.Hour},
+		{"reset", RateLimit{Limit: 60, Remaining: 0, Reset: now.Add(-time.Minute)}, 0},
+		{"retry after", RateLimit{Limit: 60, Remaining: 30, RetryAfter: now.Add(time.Minute)}, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := tt.rateLimit.Wait(now); got != tt.wait {
+			t.Errorf("%s: expected wait is %v, got %v", tt.name, tt.wait, got)
+		}
+	}
+}
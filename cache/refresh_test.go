@@ -0,0 +1,363 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+func fakeRelease(tag string, draft bool, prerelease bool) *github.RepositoryRelease {
+	name := "App-" + tag + ".dmg"
+	url := "https://github.com/atom/atom/releases/download/" + tag + "/" + name
+	return &github.RepositoryRelease{
+		TagName:     github.String(tag),
+		Body:        github.String(""),
+		Draft:       github.Bool(draft),
+		Prerelease:  github.Bool(prerelease),
+		PublishedAt: &github.Timestamp{Time: time.Date(2020, 11, 10, 0, 0, 0, 0, time.UTC)},
+		Assets: []*github.ReleaseAsset{{
+			ID:                 github.Int64(1),
+			Name:               github.String(name),
+			URL:                github.String(url),
+			BrowserDownloadURL: github.String(url),
+			ContentType:        github.String("application/octet-stream"),
+			Size:               github.Int(1000000),
+		}},
+	}
+}
+
+// fakeReleasesAPI serves pages of releases in publishing order, and the one marked latest.
+func fakeReleasesAPI(pages [][]*github.RepositoryRelease, marked string, requested map[int]bool) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/repos/atom/atom/releases/latest":
+			for _, page := range pages {
+				for _, release := range page {
+					if *release.TagName == marked {
+						json.NewEncoder(w).Encode(release)
+						return
+					}
+				}
+			}
+			http.NotFound(w, r)
+		case "/api/v3/repos/atom/atom/releases":
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page < 1 {
+				page = 1
+			}
+			requested[page] = true
+			if page < len(pages) {
+				w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/repos/atom/atom/releases?page=%d>; rel="next"`, srv.URL, page+1))
+			}
+			json.NewEncoder(w).Encode(pages[page-1])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv
+}
+
+func TestGithubCache_RefreshCache(t *testing.T) {
+	// A beta without the prerelease flag, and a hotfix of 2.9 published after 3.0.0.
+	pages := [][]*github.RepositoryRelease{
+		{fakeRelease("v3.1.0", true, false), fakeRelease("v3.2.0-beta.1", false, false)},
+		{fakeRelease("v2.9.1", false, false), fakeRelease("v3.0.0", false, false)},
+		{fakeRelease("v2.9.0", false, false), fakeRelease("v1.0.0", false, false)},
+	}
+
+	tests := []struct {
+		latestPolicy string
+		marked       string
+		history      []string
+		latest       string
+		pages        int
+	}{
+		{LatestSemver, "", []string{"v3.2.0-beta.1", "v3.0.0", "v2.9.1"}, "v3.0.0", 2},
+		// 3.0.0 and the hotfix are published without make_latest.
+		{LatestGithub, "v2.9.0", []string{"v3.2.0-beta.1", "v2.9.0", "v1.0.0"}, "v2.9.0", 3},
+		// No release is marked latest.
+		{LatestGithub, "", []string{"v3.2.0-beta.1", "v3.0.0", "v2.9.1"}, "v3.0.0", 2},
+	}
+	for _, tt := range tests {
+		requested := make(map[int]bool)
+		srv := fakeReleasesAPI(pages, tt.marked, requested)
+
+		dir, err := ioutil.TempDir("", "gohazel-refresh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := &GithubConfig{Owner: "atom", Repo: "atom", APIURL: srv.URL, Latest: tt.latestPolicy}
+		g := NewGithubCache(conf, &Options{CacheDir: dir, KeepReleases: 3, Offline: true})
+		if err := g.refreshCache(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		var history []string
+		for _, release := range g.LoadReleases() {
+			history = append(history, release.Version)
+		}
+		if fmt.Sprint(history) != fmt.Sprint(tt.history) {
+			t.Errorf("%s %q: expected history is %v, got %v", tt.latestPolicy, tt.marked, tt.history, history)
+		}
+		if latest := g.LoadCache(); latest == nil || latest.Version != tt.latest {
+			t.Errorf("%s %q: expected latest is %s, got %v", tt.latestPolicy, tt.marked, tt.latest, latest)
+		}
+		if len(requested) != tt.pages {
+			t.Errorf("%s %q: expected %d pages are requested, got %v", tt.latestPolicy, tt.marked, tt.pages, requested)
+		}
+
+		g.Stop()
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGithubCache_NewApp(t *testing.T) {
+	desktop := fakeRelease("desktop-v2.3.0", false, false)
+	checksum := *desktop.Assets[0]
+	checksum.Name = github.String(*checksum.Name + ".sha256")
+	desktop.Assets = append(desktop.Assets, &checksum)
+	// Only checksums are uploaded.
+	incomplete := fakeRelease("desktop-v2.2.0", false, false)
+	incomplete.Assets[0].Name = github.String("App-desktop-v2.2.0.dmg.sha256")
+	pages := [][]*github.RepositoryRelease{
+		{fakeRelease("cli-v1.1.0", false, false), desktop},
+		{incomplete, fakeRelease("desktop-v2.1.0", false, false)},
+		{fakeRelease("cli-v1.0.0", false, false)},
+	}
+	requested := make(map[int]bool)
+	srv := fakeReleasesAPI(pages, "", requested)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "gohazel-apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &GithubConfig{Owner: "atom", Repo: "atom", APIURL: srv.URL}
+	conf.TagPrefix = "desktop-"
+	conf.ExcludeAssets = []string{`\.sha256$`}
+	g := NewGithubCache(conf, &Options{CacheDir: dir, KeepReleases: 2, Offline: true})
+	defer g.Stop()
+	cli := g.NewApp("cli", &ReleaseFilter{TagPattern: `^cli-(.+)$`}, &Options{CacheDir: dir + "/cli", KeepReleases: 2, Offline: true})
+	if cli.api != g.api {
+		t.Error("expected the api client is shared")
+	}
+
+	for _, c := range []*GithubCache{g, cli} {
+		if err := c.refreshCache(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		cache   *GithubCache
+		history string
+	}{
+		{g, "[v2.3.0 v2.1.0]"},
+		{cli, "[v1.1.0 v1.0.0]"},
+	} {
+		var history []string
+		for _, release := range tt.cache.LoadReleases() {
+			history = append(history, release.Version)
+		}
+		if fmt.Sprint(history) != tt.history {
+			t.Errorf("expected history is %s, got %v", tt.history, history)
+		}
+	}
+
+	latest := g.LoadCache()
+	if latest.Tag != "desktop-v2.3.0" || len(latest.Platforms) != 1 || latest.Platforms["dmg"].Name != "App-desktop-v2.3.0.dmg" {
+		t.Errorf("unexpected latest desktop release: %+v", latest)
+	}
+}
+
+func TestGithubCache_NewApp_LatestGithub(t *testing.T) {
+	pages := [][]*github.RepositoryRelease{
+		{fakeRelease("cli-v5.0.0", false, false), fakeRelease("desktop-v2.3.0", false, false)},
+		{fakeRelease("desktop-v2.2.0", false, false), fakeRelease("cli-v4.0.0", false, false)},
+	}
+	// 2.3.0 of desktop is published without make_latest.
+	srv := fakeReleasesAPI(pages, "desktop-v2.2.0", make(map[int]bool))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "gohazel-apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &GithubConfig{Owner: "atom", Repo: "atom", APIURL: srv.URL, Latest: LatestGithub}
+	conf.TagPrefix = "desktop-"
+	g := NewGithubCache(conf, &Options{CacheDir: dir, KeepReleases: 2, Offline: true})
+	defer g.Stop()
+	cli := g.NewApp("cli", &ReleaseFilter{TagPrefix: "cli-"}, &Options{CacheDir: dir + "/cli", KeepReleases: 2, Offline: true})
+
+	for _, tt := range []struct {
+		cache  *GithubCache
+		latest string
+	}{
+		{g, "v2.2.0"},
+		// The marked one is of another app, which doesn't limit it.
+		{cli, "v5.0.0"},
+	} {
+		if err := tt.cache.refreshCache(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if latest := tt.cache.LoadCache(); latest == nil || latest.Version != tt.latest {
+			t.Errorf("expected latest is %s, got %v", tt.latest, latest)
+		}
+	}
+}
+
+func TestGithubCache_Install(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-install")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &GithubConfig{Owner: "atom", Repo: "atom"}
+	g := NewGithubCache(conf, &Options{CacheDir: dir, KeepReleases: 30, Offline: true})
+	defer g.Stop()
+
+	// Concurrent installs are merged one by one without losing any one.
+	var sizes []int
+	g.AddRefreshHook(func(ctx context.Context, releases []*Release) {
+		sizes = append(sizes, len(releases))
+	})
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			g.Install(context.Background(), []*Release{{Version: fmt.Sprintf("v1.%d.0", i), Platforms: map[string]*Asset{}}})
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if history := g.LoadReleases(); len(history) != 20 || history[0].Version != "v1.19.0" {
+		t.Errorf("expected 20 releases from v1.19.0, got %v", history)
+	}
+	for i, size := range sizes {
+		if size != i+1 {
+			t.Fatalf("expected history grows one by one, got %v", sizes)
+		}
+	}
+}
+
+func TestGithubCache_BuildRelease_LatestYml(t *testing.T) {
+	names := []string{"latest.yml", "latest-mac.yml", "latest-linux.yml", "App-Setup-1.0.0.exe", "App-1.0.0-mac.zip", "App-1.0.0.dmg", "App-1.0.0.AppImage"}
+	ymls := map[string]string{
+		"latest.yml":     "version: 1.0.0\nfiles:\n  - url: App-Setup-1.0.0.exe\npath: App-Setup-1.0.0.exe\n",
+		"latest-mac.yml": "version: 1.0.0\nfiles:\n  - url: App-1.0.0-mac.zip\n  - url: App-1.0.0.dmg\npath: App-1.0.0-mac.zip\n",
+		// No path in it.
+		"latest-linux.yml": "version: 1.0.0\nfiles:\n  - url: App-1.0.0.AppImage\n",
+	}
+	// Assets are downloaded by their ids.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(path.Base(r.URL.Path))
+		if id < 1 || id > len(names) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(ymls[names[id-1]]))
+	}))
+	defer srv.Close()
+
+	release := fakeRelease("v1.0.0", false, false)
+	asset := *release.Assets[0]
+	release.Assets = nil
+	for i, name := range names {
+		a := asset
+		a.ID = github.Int64(int64(i + 1))
+		a.Name = github.String(name)
+		release.Assets = append(release.Assets, &a)
+	}
+
+	dir, err := ioutil.TempDir("", "gohazel-yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &GithubConfig{Owner: "atom", Repo: "atom", APIURL: srv.URL}
+	g := NewGithubCache(conf, &Options{
+		CacheDir:      dir,
+		Offline:       true,
+		PlatformRules: []PlatformRule{{Pattern: `-Setup-.*\.exe$`, Target: "win-nsis"}},
+	})
+	defer g.Stop()
+	r, err := g.buildRelease(context.Background(), release, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The yml is bound to the installer in it, whatever platform it's classified.
+	for platform, yml := range map[string]string{
+		"win-nsis": "latest.yml",
+		"darwin":   "latest-mac.yml",
+		"dmg":      "",
+		"AppImage": "latest-linux.yml",
+	} {
+		asset := r.Platforms[platform]
+		if asset == nil {
+			t.Fatalf("expected asset of %s, got %v", platform, r.Platforms)
+		}
+		if yml == "" {
+			if asset.Yml != nil {
+				t.Errorf("%s: expected no latest yml, got %s", platform, asset.Yml.Content)
+			}
+			continue
+		}
+		if asset.Yml == nil || asset.Yml.Content != ymls[yml] {
+			t.Errorf("%s: expected latest yml %s, got %+v", platform, yml, asset.Yml)
+		}
+	}
+}
+
+func TestGithubCache_StopCancelsHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	g := NewGithubCache(&GithubConfig{Owner: "atom", Repo: "atom"}, &Options{CacheDir: dir, Offline: true})
+	g.Install(context.Background(), []*Release{{Version: "v1.0.0", Platforms: map[string]*Asset{}}})
+
+	// The hook is called in background with the loaded history, and canceled by stopping.
+	started := make(chan struct{})
+	g.AddRefreshHook(func(ctx context.Context, releases []*Release) {
+		close(started)
+		<-ctx.Done()
+	})
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		g.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected the hook is canceled by stopping")
+	}
+}
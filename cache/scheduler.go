@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Defaults of the scheduler config.
+const (
+	defaultRefreshInterval = 3 * time.Minute
+	defaultMaxBackoff      = 30 * time.Minute
+	// minBackoff is the delay after the first failure, doubled after each following one.
+	minBackoff = 30 * time.Second
+)
+
+// SchedulerConfig of refreshing releases.
+type SchedulerConfig struct {
+	// Interval between refreshes, default 3m.
+	Interval time.Duration `yaml:"interval"`
+	// Jitter is the max random delay added to the interval, so instances don't poll at the same time.
+	Jitter time.Duration `yaml:"jitter"`
+	// MaxBackoff is the max delay of retrying after failures, default 30m.
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+}
+
+// SchedulerState is the state of scheduled runs.
+type SchedulerState struct {
+	Running     bool      `json:"running"`
+	LastRun     time.Time `json:"lastRun"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastError   string    `json:"lastError,omitempty"`
+	Failures    int       `json:"failures"`
+	NextRun     time.Time `json:"nextRun"`
+}
+
+// Scheduler runs the task periodically with jitter, backs off exponentially after failures,
+// and runs it at once when it's triggered. Runs never overlap, triggers during a run are
+// merged into one following run. Stopping cancels the context of the running one.
+type Scheduler struct {
+	conf      SchedulerConfig
+	task      func(ctx context.Context) error
+	hold      func() time.Duration
+	triggerCh chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	started   bool
+	state     SchedulerState
+}
+
+// NewScheduler returns a scheduler of the task, hold returns how long runs should be held,
+// e.g. until the rate limit resets.
+func NewScheduler(conf SchedulerConfig, task func(ctx context.Context) error, hold func() time.Duration) *Scheduler {
+	if conf.Interval <= 0 {
+		conf.Interval = defaultRefreshInterval
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = defaultMaxBackoff
+	}
+	if hold == nil {
+		hold = func() time.Duration { return 0 }
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		conf:      conf,
+		task:      task,
+		hold:      hold,
+		triggerCh: make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Start runs the task at once, and then on schedule.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop cancels the running task and waits for it.
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Trigger requests a run as soon as possible, it doesn't wait for the run.
+func (s *Scheduler) Trigger() {
+	select {
+	case s.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+// State returns the state of scheduled runs.
+func (s *Scheduler) State() SchedulerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.triggerCh:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+
+		if hold := s.hold(); hold > 0 {
+			log.Debug().Dur("hold", hold).Msg("Scheduled run held")
+			s.setNextRun(hold)
+			timer.Reset(hold)
+			continue
+		}
+
+		delay := s.runTask()
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.setNextRun(delay)
+		timer.Reset(delay)
+	}
+}
+
+// runTask runs the task and returns the delay of the next run.
+func (s *Scheduler) runTask() time.Duration {
+	s.mu.Lock()
+	s.state.Running = true
+	s.state.LastRun = time.Now()
+	s.mu.Unlock()
+
+	err := s.task(s.ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Running = false
+	// Canceled by stopping, it's not a failure.
+	if s.ctx.Err() != nil {
+		return 0
+	}
+	if err != nil {
+		s.state.Failures++
+		s.state.LastError = err.Error()
+		delay := s.backoff(s.state.Failures)
+		log.Error().Err(err).Int("failures", s.state.Failures).Dur("retry", delay).Msg("Scheduled run")
+		return delay
+	}
+	s.state.Failures = 0
+	s.state.LastError = ""
+	s.state.LastSuccess = time.Now()
+	return s.conf.Interval + s.jitter()
+}
+
+func (s *Scheduler) backoff(failures int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < failures && delay < s.conf.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.conf.MaxBackoff {
+		delay = s.conf.MaxBackoff
+	}
+	return delay
+}
+
+func (s *Scheduler) jitter() time.Duration {
+	if s.conf.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(s.conf.Jitter)))
+}
+
+func (s *Scheduler) setNextRun(delay time.Duration) {
+	s.mu.Lock()
+	s.state.NextRun = time.Now().Add(delay)
+	s.mu.Unlock()
+}
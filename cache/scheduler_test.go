@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerBackoff(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{MaxBackoff: 5 * time.Minute}, nil, nil)
+	for failures, expected := range map[int]time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		3: 2 * time.Minute,
+		4: 4 * time.Minute,
+		5: 5 * time.Minute,
+		9: 5 * time.Minute,
+	} {
+		if delay := s.backoff(failures); delay != expected {
+			t.Errorf("expected backoff of %d failures is %s, got %s", failures, expected, delay)
+		}
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Jitter: time.Second}, nil, nil)
+	for i := 0; i < 100; i++ {
+		if j := s.jitter(); j < 0 || j >= time.Second {
+			t.Fatalf("jitter %s out of range", j)
+		}
+	}
+}
+
+func TestSchedulerTrigger(t *testing.T) {
+	var runs int32
+	var running int32
+	done := make(chan struct{}, 10)
+	s := NewScheduler(SchedulerConfig{Interval: time.Hour}, func(ctx context.Context) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			t.Error("overlapping runs")
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&runs, 1)
+		done <- struct{}{}
+		return nil
+	}, nil)
+	s.Start()
+	defer s.Stop()
+
+	// The first run at start.
+	<-done
+	// Triggers during a run are merged into one following run.
+	s.Trigger()
+	s.Trigger()
+	s.Trigger()
+	<-done
+	select {
+	case <-done:
+		// The third trigger may land after the second run started.
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := atomic.LoadInt32(&runs); n < 2 || n > 3 {
+		t.Errorf("expected 2 or 3 runs, got %d", n)
+	}
+
+	state := s.State()
+	if state.LastSuccess.IsZero() || state.Failures != 0 {
+		t.Errorf("unexpected state: %+v", state)
+	}
+	if next := time.Until(state.NextRun); next < 59*time.Minute {
+		t.Errorf("expected next run after the interval, got %s", next)
+	}
+}
+
+func TestSchedulerFailure(t *testing.T) {
+	done := make(chan struct{}, 1)
+	s := NewScheduler(SchedulerConfig{}, func(ctx context.Context) error {
+		done <- struct{}{}
+		return errors.New("boom")
+	}, nil)
+	s.Start()
+	defer s.Stop()
+
+	<-done
+	s.Trigger()
+	<-done
+	// Wait for the state recorded after the run.
+	time.Sleep(20 * time.Millisecond)
+	state := s.State()
+	if state.Failures != 2 || state.LastError != "boom" {
+		t.Errorf("unexpected state: %+v", state)
+	}
+	if next := time.Until(state.NextRun); next > time.Minute || next < 50*time.Second {
+		t.Errorf("expected next run after backoff of 1m, got %s", next)
+	}
+}
+
+func TestSchedulerHold(t *testing.T) {
+	var runs int32
+	s := NewScheduler(SchedulerConfig{}, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, func() time.Duration { return time.Hour })
+	s.Start()
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+
+	if n := atomic.LoadInt32(&runs); n != 0 {
+		t.Errorf("expected no run while held, got %d", n)
+	}
+	if next := time.Until(s.State().NextRun); next < 59*time.Minute {
+		t.Errorf("expected next run after the hold, got %s", next)
+	}
+}
+
+func TestSchedulerStopCancels(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	s := NewScheduler(SchedulerConfig{}, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}, nil)
+	s.Start()
+	<-started
+	s.Stop()
+
+	select {
+	case <-canceled:
+	default:
+		t.Fatal("expected the running task is canceled")
+	}
+	if state := s.State(); state.Failures != 0 || state.Running {
+		t.Errorf("unexpected state after stop: %+v", state)
+	}
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"fmt"
+
+	"golang.org/x/mod/semver"
+)
+
+// SteppingStone is a release clients must update to before newer ones,
+// e.g. the one migrating the local database format.
+type SteppingStone struct {
+	Version string `yaml:"version" json:"version"`
+	Reason  string `yaml:"reason" json:"reason,omitempty"`
+}
+
+// Validate checks the version of the stepping stone.
+func (s *SteppingStone) Validate() error {
+	if !semver.IsValid(canonicalVersion(s.Version)) {
+		return fmt.Errorf("invalid stepping stone version %q", s.Version)
+	}
+	return nil
+}
+
+// NextStone returns the lowest stepping stone between the client version and the target,
+// which the client must update to first. It's nil if there is no one.
+func (p *UpdatePolicy) NextStone(version string, target string) *SteppingStone {
+	v, t := canonicalVersion(version), canonicalVersion(target)
+	var next *SteppingStone
+	for i := range p.SteppingStones {
+		stone := &p.SteppingStones[i]
+		s := canonicalVersion(stone.Version)
+		if semver.Compare(v, s) >= 0 || semver.Compare(s, t) >= 0 {
+			continue
+		}
+		if next == nil || semver.Compare(s, canonicalVersion(next.Version)) < 0 {
+			next = stone
+		}
+	}
+	return next
+}
@@ -0,0 +1,72 @@
+package cache
+
+import "testing"
+
+func TestUpdatePolicy_NextStone(t *testing.T) {
+	p := &UpdatePolicy{SteppingStones: []SteppingStone{
+		{Version: "v2.9.0", Reason: "Migrate database"},
+		{Version: "1.9"},
+	}}
+	tests := []struct {
+		version string
+		target  string
+		stone   string
+	}{
+		// Below both stones, the lowest one first.
+		{"v1.0.0", "v3.2.0", "1.9"},
+		{"1.8.9", "v2.0.0", "1.9"},
+		// On a stone.
+		{"v1.9.0", "v3.2.0", "v2.9.0"},
+		{"v2.9.0", "v3.2.0", ""},
+		// Between and beyond stones.
+		{"v2.0.0", "v3.2.0", "v2.9.0"},
+		{"v2.8.5", "v2.9.0", ""},
+		{"v2.8.5", "v2.9.1", "v2.9.0"},
+		{"v3.0.0", "v3.2.0", ""},
+		// Targets below stones.
+		{"v1.0.0", "v1.9.0", ""},
+		{"v2.0.0", "v2.8.0", ""},
+		// Prereleases are below the stone.
+		{"v2.9.0-beta.1", "v3.0.0", "v2.9.0"},
+	}
+	for _, tt := range tests {
+		stone := p.NextStone(tt.version, tt.target)
+		got := ""
+		if stone != nil {
+			got = stone.Version
+		}
+		if got != tt.stone {
+			t.Errorf("%s -> %s: expected stone is %q, got %q", tt.version, tt.target, tt.stone, got)
+		}
+	}
+}
+
+func TestSteppingStone_Validate(t *testing.T) {
+	tests := map[string]bool{
+		"v2.9.0": true,
+		"2.9":    true,
+		"latest": false,
+		"":       false,
+	}
+	for version, valid := range tests {
+		s := &SteppingStone{Version: version}
+		if err := s.Validate(); (err == nil) != valid {
+			t.Errorf("%q: expected valid is %v, got %v", version, valid, err)
+		}
+	}
+}
+
+func TestGithubCache_TrimHistory_SteppingStones(t *testing.T) {
+	var history []*Release
+	for _, v := range []string{"v3.2.0", "v3.1.0", "v2.9.1", "v2.9.0", "v2.8.0"} {
+		history = append(history, &Release{Version: v})
+	}
+	g := &GithubCache{keepReleases: 2, stones: []SteppingStone{{Version: "2.9.0"}}}
+	trimmed := g.trimHistory(history)
+	if len(trimmed) != 3 || trimmed[2].Version != "v2.9.0" {
+		t.Errorf("expected the stepping stone is kept, got %d releases", len(trimmed))
+	}
+	if g.hasKept(trimmed[:2]) || !g.hasKept(trimmed) {
+		t.Error("unexpected kept check")
+	}
+}
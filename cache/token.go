@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panjiang/gohazel/pkg/logger"
+	"golang.org/x/oauth2"
+)
+
+// tokenCommandTTL is how long the token printed by the credential helper is reused.
+const tokenCommandTTL = 5 * time.Minute
+
+// tokenCommandTimeout bounds running the credential helper, which holds the lock of tokens.
+var tokenCommandTimeout = 30 * time.Second
+
+// tokenSource resolves the github token from the configured token, Github App,
+// token file, credential helper or environment in order. The token file is read again after it's changed,
+// e.g. a rotated Kubernetes secret, and resolved tokens are redacted from logs.
+type tokenSource struct {
+	conf    *GithubConfig
+	app     *appTokenSource
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	expiry  time.Time
+}
+
+func newTokenSource(conf *GithubConfig, client *http.Client) *tokenSource {
+	logger.AddSecret(conf.Token, conf.EnvToken)
+	s := &tokenSource{conf: conf}
+	if conf.App.ID != 0 {
+		s.app = newAppTokenSource(&conf.App, conf.APIBaseURL(), client)
+	}
+	return s
+}
+
+// Token implements oauth2.TokenSource.
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: token}, nil
+}
+
+func (s *tokenSource) resolve() (string, error) {
+	if s.conf.Token != "" {
+		return s.conf.Token, nil
+	}
+	if s.app != nil {
+		token, err := s.app.resolve()
+		if err != nil {
+			return "", err
+		}
+		logger.AddSecret(token)
+		return token, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.conf.TokenFile != "":
+		info, err := os.Stat(s.conf.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		if s.token != "" && info.ModTime().Equal(s.modTime) {
+			return s.token, nil
+		}
+		b, err := ioutil.ReadFile(s.conf.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		s.setToken(string(b))
+		s.modTime = info.ModTime()
+	case len(s.conf.TokenCommand) > 0:
+		if s.token != "" && time.Now().Before(s.expiry) {
+			return s.token, nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), tokenCommandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, s.conf.TokenCommand[0], s.conf.TokenCommand[1:]...)
+		b, err := cmd.Output()
+		if err != nil {
+			return "", err
+		}
+		s.setToken(string(b))
+		s.expiry = time.Now().Add(tokenCommandTTL)
+	default:
+		s.token = s.conf.EnvToken
+	}
+
+	if s.token == "" {
+		return "", errors.New("empty github token")
+	}
+	return s.token, nil
+}
+
+func (s *tokenSource) setToken(token string) {
+	s.token = strings.TrimSpace(token)
+	logger.AddSecret(s.token)
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/panjiang/gohazel/pkg/logger"
+)
+
+func TestTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("file-token-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		conf  *GithubConfig
+		token string
+	}{
+		{"static", &GithubConfig{Token: "static-token", TokenFile: tokenFile}, "static-token"},
+		{"file", &GithubConfig{TokenFile: tokenFile}, "file-token-1"},
+		{"command", &GithubConfig{TokenCommand: []string{"echo", "command-token"}}, "command-token"},
+	}
+	for _, tt := range tests {
+		token, err := newTokenSource(tt.conf, http.DefaultClient).resolve()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if token != tt.token {
+			t.Errorf("%s: expected token is %q, got %q", tt.name, tt.token, token)
+		}
+		if got := logger.Redact("url: https://" + token + "@api.github.com/"); got != "url: https://"+logger.Redacted+"@api.github.com/" {
+			t.Errorf("%s: token is not redacted: %s", tt.name, got)
+		}
+	}
+
+	// Reload after the file is changed.
+	s := newTokenSource(&GithubConfig{TokenFile: tokenFile}, http.DefaultClient)
+	if token, _ := s.resolve(); token != "file-token-1" {
+		t.Fatalf("expected token is file-token-1, got %q", token)
+	}
+	if err := ioutil.WriteFile(tokenFile, []byte("file-token-2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tokenFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := s.resolve(); token != "file-token-2" {
+		t.Errorf("expected reloaded token is file-token-2, got %q", token)
+	}
+
+	if err := ioutil.WriteFile(tokenFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTokenSource(&GithubConfig{TokenFile: tokenFile}, http.DefaultClient).resolve(); err == nil {
+		t.Error("expected error of empty token")
+	}
+}
+
+func TestTokenSource_CommandTimeout(t *testing.T) {
+	timeout := tokenCommandTimeout
+	tokenCommandTimeout = 100 * time.Millisecond
+	defer func() { tokenCommandTimeout = timeout }()
+
+	s := newTokenSource(&GithubConfig{TokenCommand: []string{"sleep", "10"}}, http.DefaultClient)
+	startAt := time.Now()
+	if _, err := s.resolve(); err == nil {
+		t.Error("expected error of hung credential helper")
+	}
+	if d := time.Since(startAt); d > 5*time.Second {
+		t.Errorf("credential helper isn't killed in time, took %v", d)
+	}
+}
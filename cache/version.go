@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"golang.org/x/mod/semver"
+)
+
+// canonicalVersion formats the version tag for comparing,
+// e.g. `1.2` and `v1.2.0` are both `v1.2.0`.
+func canonicalVersion(version string) string {
+	if len(version) > 0 && version[0] != 'v' {
+		version = "v" + version
+	}
+	if c := semver.Canonical(version); c != "" {
+		return c
+	}
+	return version
+}
+
+func findRelease(releases []*Release, version string) *Release {
+	version = canonicalVersion(version)
+	for _, release := range releases {
+		if canonicalVersion(release.Version) == version {
+			return release
+		}
+	}
+	return nil
+}
+
+// compareVersions compares versions by semver, invalid ones are lower than valid ones.
+func compareVersions(v, w string) int {
+	return semver.Compare(canonicalVersion(v), canonicalVersion(w))
+}
+
+// latestRelease returns the highest release of the stable channel in history ordered by semver,
+// or the highest one if there is no stable release.
+func latestRelease(history []*Release) *Release {
+	for _, release := range history {
+		if release.Channel() == StableChannel {
+			return release
+		}
+	}
+	return history[0]
+}
+
+// LatestOfChannels returns the highest release of each channel in history ordered by semver,
+// the one of the stable channel is the latest served.
+func LatestOfChannels(history []*Release) map[string]*Release {
+	latest := make(map[string]*Release)
+	for _, release := range history {
+		if _, ok := latest[release.Channel()]; !ok {
+			latest[release.Channel()] = release
+		}
+	}
+	return latest
+}
@@ -3,24 +3,91 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
 
+	"github.com/panjiang/gohazel/bundle"
 	"github.com/panjiang/gohazel/cache"
+	"github.com/panjiang/gohazel/patch"
+	"github.com/panjiang/gohazel/pkg/logger"
+	"github.com/panjiang/gohazel/repo"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v2"
 )
 
+// LandingConfig of the public HTML download page.
+type LandingConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Title       string `yaml:"title"`
+	Logo        string `yaml:"logo"`
+	TemplateDir string `yaml:"templateDir"`
+}
+
+// ManifestsConfig of package manager manifests rendered for the latest release.
+type ManifestsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ID is the winget package identifier, e.g. `GitHub.Atom`.
+	ID          string `yaml:"id"`
+	Name        string `yaml:"name"`
+	Publisher   string `yaml:"publisher"`
+	License     string `yaml:"license"`
+	Description string `yaml:"description"`
+	Homepage    string `yaml:"homepage"`
+	TemplateDir string `yaml:"templateDir"`
+}
+
+// CompatConfig enables route sets compatible with other update servers.
+type CompatConfig struct {
+	Electron bool `yaml:"electron"` // update.electronjs.org
+	Nuts     bool `yaml:"nuts"`
+}
+
+// AdminConfig of the admin API, which is disabled without a token.
+type AdminConfig struct {
+	// Token is checked in `Authorization: Bearer <token>` header.
+	Token string `yaml:"token"`
+}
+
+// AppConfig of another app released in the same github repo, e.g. a monorepo,
+// which is served under `/apps/<name>/`.
+type AppConfig struct {
+	Name                string `yaml:"name"`
+	cache.ReleaseFilter `yaml:",inline"`
+}
+
+var appNameReg = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 // Config of the server
 type Config struct {
-	Addr          string             `yaml:"addr"`
-	Debug         bool               `yaml:"debug"`
-	BaseURL       string             `yaml:"baseURL"`
-	CacheDir      string             `yaml:"cacheDir"`
-	ProxyDownload bool               `yaml:"proxyDownload"`
-	Github        cache.GithubConfig `yaml:"github"`
+	Addr            string               `yaml:"addr"`
+	Debug           bool                 `yaml:"debug"`
+	BaseURL         string               `yaml:"baseURL"`
+	CacheDir        string               `yaml:"cacheDir"`
+	ProxyDownload   bool                 `yaml:"proxyDownload"`
+	KeepReleases    int                  `yaml:"keepReleases"`
+	BlockedVersions []string             `yaml:"blockedVersions"`
+	Platforms       []cache.PlatformRule `yaml:"platforms"`
+	Github          cache.GithubConfig   `yaml:"github"`
+	Landing         LandingConfig        `yaml:"landing"`
+	Compat          CompatConfig         `yaml:"compat"`
+	Manifests       ManifestsConfig      `yaml:"manifests"`
+	Admin           AdminConfig          `yaml:"admin"`
+	// Offline uses the cached release data only, e.g. for exporting.
+	Offline bool                  `yaml:"-"`
+	Signing repo.SigningConfig    `yaml:"signing"`
+	Apt     repo.AptConfig        `yaml:"apt"`
+	Yum     repo.YumConfig        `yaml:"yum"`
+	Patch   patch.Config          `yaml:"patch"`
+	Nuget   repo.NugetConfig      `yaml:"nuget"`
+	Bundle  bundle.Config         `yaml:"bundle"`
+	Refresh cache.SchedulerConfig `yaml:"refresh"`
+	Apps    []AppConfig           `yaml:"apps"`
+	Update  cache.UpdatePolicy    `yaml:"update"`
 }
 
 // CacheURLPath the url path of handling cache files.
@@ -35,6 +102,77 @@ func (c *Config) CacheURLBase() string {
 	return u.String()
 }
 
+// AptDir the dir of generated APT repository.
+func (c *Config) AptDir() string {
+	return filepath.Join(c.CacheDir, "apt")
+}
+
+// YumDir the dir of generated YUM repository.
+func (c *Config) YumDir() string {
+	return filepath.Join(c.CacheDir, "yum")
+}
+
+// YumURL the public url of generated YUM repository.
+func (c *Config) YumURL() string {
+	u, _ := url.Parse(c.BaseURL)
+	u.Path = path.Join(u.Path, "yum")
+	return u.String()
+}
+
+// CacheOptions returns options for creating the release cache.
+func (c *Config) CacheOptions() *cache.Options {
+	return &cache.Options{
+		CacheDir:        c.CacheDir,
+		ProxyDownload:   c.ProxyDownload,
+		CacheURLBase:    c.CacheURLBase(),
+		KeepReleases:    c.KeepReleases,
+		BlockedVersions: c.BlockedVersions,
+		PlatformRules:   c.Platforms,
+		Offline:         c.Offline,
+		Refresh:         c.Refresh,
+		Lines:           c.Update.Lines,
+		SteppingStones:  c.Update.SteppingStones,
+	}
+}
+
+// AppPath returns the url path of the app, relative to the base url.
+func (c *Config) AppPath(app *AppConfig) string {
+	return path.Join("apps", app.Name)
+}
+
+// App returns the config of serving the app, whose releases and cache files are separated,
+// repositories and feeds of the main app are not served for it.
+func (c *Config) App(app *AppConfig) *Config {
+	conf := *c
+	u, _ := url.Parse(c.BaseURL)
+	u.Path = path.Join(u.Path, c.AppPath(app))
+	conf.BaseURL = u.String()
+	conf.CacheDir = filepath.Join(c.CacheDir, "apps", app.Name)
+	conf.Github.ReleaseFilter = app.ReleaseFilter
+	conf.Github.WebhookSecret = ""
+	conf.Admin = AdminConfig{}
+	conf.Compat = CompatConfig{}
+	conf.Manifests = ManifestsConfig{}
+	conf.Apt = repo.AptConfig{}
+	conf.Yum = repo.YumConfig{}
+	conf.Nuget = repo.NugetConfig{}
+	conf.Patch = patch.Config{}
+	conf.Bundle = bundle.Config{}
+	conf.Apps = nil
+	return &conf
+}
+
+// Redacted returns a copy of the config with secrets replaced, for showing it.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	for _, secret := range []*string{&redacted.Github.Token, &redacted.Github.WebhookSecret, &redacted.Admin.Token, &redacted.Signing.Passphrase} {
+		if *secret != "" {
+			*secret = logger.Redacted
+		}
+	}
+	return &redacted
+}
+
 // Validate some config items.
 func (c *Config) Validate() error {
 	if c.Github.Owner == "" || c.Github.Repo == "" {
@@ -49,10 +187,100 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if _, err := c.Github.HTTPClient(); err != nil {
+		return err
+	}
+
+	if c.Github.App.ID != 0 {
+		if c.Github.App.InstallationID == 0 {
+			return errors.New("no github app installation id")
+		}
+		if _, err := os.Stat(c.Github.App.PrivateKeyFile); err != nil {
+			return err
+		}
+	}
+
+	if c.Github.TokenFile != "" {
+		if _, err := os.Stat(c.Github.TokenFile); err != nil {
+			return err
+		}
+	}
+
+	if _, err := cache.NewFilter(&c.Github.ReleaseFilter); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, app := range c.Apps {
+		if !appNameReg.MatchString(app.Name) {
+			return fmt.Errorf("invalid app name: %q", app.Name)
+		}
+		if names[app.Name] {
+			return fmt.Errorf("duplicate app name: %s", app.Name)
+		}
+		names[app.Name] = true
+		if _, err := cache.NewFilter(&app.ReleaseFilter); err != nil {
+			return fmt.Errorf("app %s: %w", app.Name, err)
+		}
+	}
+
+	if err := c.Update.Validate(); err != nil {
+		return err
+	}
+
+	switch c.Github.Latest {
+	case "", cache.LatestSemver, cache.LatestGithub:
+	default:
+		return fmt.Errorf("unknown github latest policy: %s", c.Github.Latest)
+	}
+
 	if c.Github.IsPrivateRepo() && !c.ProxyDownload {
 		return errors.New("private repo should open proxyDownload")
 	}
 
+	if _, err := cache.NewClassifier(c.Platforms); err != nil {
+		return err
+	}
+
+	if c.Apt.Enabled && !c.ProxyDownload {
+		return errors.New("APT repository should open proxyDownload")
+	}
+
+	if c.Yum.Enabled && !c.ProxyDownload {
+		return errors.New("YUM repository should open proxyDownload")
+	}
+
+	if c.Nuget.Enabled && !c.ProxyDownload {
+		return errors.New("NuGet feed should open proxyDownload")
+	}
+
+	if c.Patch.Enabled && !c.ProxyDownload {
+		return errors.New("patch should open proxyDownload")
+	}
+
+	if c.Manifests.Enabled && !c.ProxyDownload {
+		return errors.New("manifests should open proxyDownload")
+	}
+
+	if (c.Bundle.PrivateKey != "" || c.Bundle.PublicKey != "") && !c.ProxyDownload {
+		return errors.New("bundle should open proxyDownload")
+	}
+
+	if _, err := repo.NewSigner(&c.Signing); err != nil {
+		return err
+	}
+
+	if c.Landing.TemplateDir != "" {
+		if _, err := os.Stat(c.Landing.TemplateDir); err != nil {
+			return err
+		}
+	}
+
+	if c.Manifests.TemplateDir != "" {
+		if _, err := os.Stat(c.Manifests.TemplateDir); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -76,9 +304,12 @@ func Parse(fs *flag.FlagSet, args []string) (*Config, error) {
 	fs.BoolVar(&conf.Debug, "debug", false, "Open log debug level.")
 	fs.StringVar(&conf.CacheDir, "cache_dir", "/assets", "Cache files store in.")
 	fs.BoolVar(&conf.ProxyDownload, "proxy_download", false, "Proxy assets download with the server.")
+	fs.IntVar(&conf.KeepReleases, "keep_releases", 5, "Number of releases kept in history.")
 	fs.StringVar(&conf.Github.Owner, "github_owner", "atom", "Gihtub owner name.")
 	fs.StringVar(&conf.Github.Repo, "github_repo", "atom", "Github repository name.")
 	fs.StringVar(&conf.Github.Token, "github_token", "", "Github api token for private repo.")
+	fs.StringVar(&conf.Github.TokenFile, "github_token_file", "", "File of the Github api token.")
+	fs.BoolVar(&conf.Landing.Enabled, "landing", false, "Serve the HTML download page at root.")
 	fs.StringVar(&configFile, "config", "", "Configuration file.")
 	if err := fs.Parse(args); err != nil {
 		return nil, err
@@ -90,6 +321,10 @@ func Parse(fs *flag.FlagSet, args []string) (*Config, error) {
 		}
 	}
 
+	if !conf.Github.IsPrivateRepo() {
+		conf.Github.EnvToken = os.Getenv("GITHUB_TOKEN")
+	}
+
 	if err := conf.Validate(); err != nil {
 		return nil, err
 	}
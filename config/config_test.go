@@ -0,0 +1,39 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParse_EnvToken(t *testing.T) {
+	os.Setenv("GITHUB_TOKEN", "ghp_environment")
+	defer os.Unsetenv("GITHUB_TOKEN")
+	dir, err := ioutil.TempDir("", "gohazel-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A public repo without proxy download, e.g. in CI with the token set.
+	conf, err := Parse(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-cache_dir", dir, "-github_owner", "atom", "-github_repo", "atom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Github.IsPrivateRepo() {
+		t.Error("expected the repo is public")
+	}
+	if !conf.Github.HasToken() || conf.Github.EnvToken != "ghp_environment" {
+		t.Errorf("expected the env token is used for api requests, got %q", conf.Github.EnvToken)
+	}
+
+	// The configured token wins.
+	conf, err = Parse(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-cache_dir", dir, "-github_token", "ghp_flag", "-proxy_download"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Github.Token != "ghp_flag" || conf.Github.EnvToken != "" {
+		t.Errorf("unexpected tokens: %q %q", conf.Github.Token, conf.Github.EnvToken)
+	}
+}
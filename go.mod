@@ -10,10 +10,14 @@ require (
 	github.com/golang/protobuf v1.4.2 // indirect
 	github.com/google/go-github/v32 v32.1.0
 	github.com/json-iterator/go v1.1.10 // indirect
+	github.com/klauspost/compress v1.11.3
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/rs/zerolog v1.20.0
 	github.com/stretchr/testify v1.4.0
 	github.com/ugorji/go v1.1.8 // indirect
+	github.com/ulikunitz/xz v0.5.8
+	github.com/yuin/goldmark v1.2.1
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/mod v0.3.0
 	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/pkg/api"
+	"golang.org/x/mod/semver"
+)
+
+// ImportBundle verifies the uploaded bundle in request body and installs it into the cache.
+func (h *Handler) ImportBundle(c *gin.Context) {
+	if h.bundler == nil {
+		api.NotFound(c)
+		return
+	}
+
+	manifest, err := h.bundler.Import(c.Request.Context(), c.Request.Body)
+	if err != nil {
+		api.BadRequest(c, "bundle", err.Error())
+		return
+	}
+
+	var versions []string
+	for _, release := range manifest.Releases {
+		versions = append(versions, release.Version)
+	}
+	api.Ok(c, gin.H{
+		"versions":  versions,
+		"files":     len(manifest.Files),
+		"createdAt": manifest.CreatedAt,
+	})
+}
+
+// Config responses the config in YAML with secrets redacted.
+func (h *Handler) Config(c *gin.Context) {
+	c.YAML(http.StatusOK, h.conf.Redacted())
+}
+
+// UpdatePolicy responses the update policy with the latest releases of lines,
+// and the update path of the client by `version` and `allowMajor` queries.
+func (h *Handler) UpdatePolicy(c *gin.Context) {
+	policy := h.conf.Update
+	var lines []gin.H
+	for i := range policy.Lines {
+		line := gin.H{"name": policy.Lines[i].Name, "version": policy.Lines[i].Version}
+		if release := h.cache.LatestOf(&policy.Lines[i]); release != nil {
+			line["latest"] = release.Version
+		}
+		lines = append(lines, line)
+	}
+	var stones []gin.H
+	for _, stone := range policy.SteppingStones {
+		_, err := h.cache.FindRelease(stone.Version)
+		stones = append(stones, gin.H{"version": stone.Version, "reason": stone.Reason, "available": err == nil})
+	}
+	data := gin.H{
+		"pin":            policy.Pin,
+		"lines":          lines,
+		"steppingStones": stones,
+	}
+
+	if version := c.Query("version"); version != "" {
+		version = ToSemver(version)
+		if !semver.IsValid(version) {
+			api.BadRequest(c, "version", "is not SemVer-compatible")
+			return
+		}
+		allowMajor, _ := strconv.ParseBool(c.Query("allowMajor"))
+		data["path"] = h.updatePath(version, allowMajor)
+	}
+	api.Ok(c, data)
+}
+
+// Refresh triggers refreshing releases from github, it doesn't wait for the refresh.
+func (h *Handler) Refresh(c *gin.Context) {
+	h.cache.Refresh()
+	c.JSON(http.StatusAccepted, gin.H{"refresh": h.cache.RefreshState()})
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+	"github.com/panjiang/gohazel/pkg/api"
+	"github.com/rs/zerolog/log"
+)
+
+// appcastPlatforms are Sparkle update archives in order of preference.
+var appcastPlatforms = []string{"darwin", "dmg", "pkg"}
+
+type appcastEnclosure struct {
+	URL         string `xml:"url,attr"`
+	Length      int    `xml:"length,attr"`
+	Type        string `xml:"type,attr"`
+	EdSignature string `xml:"sparkle:edSignature,attr,omitempty"`
+}
+
+type appcastItem struct {
+	Title                string            `xml:"title"`
+	PubDate              string            `xml:"pubDate"`
+	Version              string            `xml:"sparkle:version"`
+	ShortVersionString   string            `xml:"sparkle:shortVersionString"`
+	ReleaseNotesLink     string            `xml:"sparkle:releaseNotesLink,omitempty"`
+	MinimumSystemVersion string            `xml:"sparkle:minimumSystemVersion,omitempty"`
+	Channel              string            `xml:"sparkle:channel,omitempty"`
+	Enclosure            *appcastEnclosure `xml:"enclosure"`
+}
+
+type appcastRSS struct {
+	XMLName      xml.Name `xml:"rss"`
+	Version      string   `xml:"version,attr"`
+	XMLNSSparkle string   `xml:"xmlns:sparkle,attr"`
+	Channel      struct {
+		Title string         `xml:"title"`
+		Link  string         `xml:"link"`
+		Items []*appcastItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+// Appcast responses the Sparkle appcast feed of the channel for native macOS apps,
+// the feed of a prerelease channel also contains stable releases.
+func (h *Handler) Appcast(c *gin.Context) {
+	channel := strings.TrimSuffix(c.Param("channel"), ".xml")
+	releases := h.cache.LoadReleases()
+	if len(releases) == 0 {
+		api.NoContent(c)
+		return
+	}
+
+	u, _ := url.Parse(h.conf.BaseURL)
+	u.Path = path.Join(u.Path, "appcast", channel+".xml")
+
+	rss := &appcastRSS{
+		Version:      "2.0",
+		XMLNSSparkle: "http://www.andymatuschak.org/xml-namespaces/sparkle",
+	}
+	rss.Channel.Title = h.conf.Github.Repo
+	rss.Channel.Link = u.String()
+	for _, release := range releases {
+		releaseChannel := release.Channel()
+		if releaseChannel != cache.StableChannel && releaseChannel != channel {
+			continue
+		}
+		if item := h.appcastItem(c.Request.Context(), release); item != nil {
+			rss.Channel.Items = append(rss.Channel.Items, item)
+		}
+	}
+
+	b, err := xml.MarshalIndent(rss, "", "  ")
+	if err != nil {
+		api.BadRequest(c, "appcast", err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/rss+xml; charset=utf-8", append([]byte(xml.Header), b...))
+}
+
+func (h *Handler) appcastItem(ctx context.Context, release *cache.Release) *appcastItem {
+	for _, platform := range appcastPlatforms {
+		asset, ok := release.Platforms[platform]
+		if !ok {
+			continue
+		}
+
+		// Sparkle downloads the enclosure directly, assets of releases
+		// other than the latest one are filled on demand.
+		downloadURL := asset.BrowserDownloadURL
+		if h.conf.ProxyDownload {
+			var err error
+			downloadURL, err = h.filledAssetURL(ctx, release, asset)
+			if err != nil {
+				log.Warn().Err(err).Str("version", release.Version).Str("name", asset.Name).Msg("Fill appcast asset")
+				return nil
+			}
+		}
+		notesLink := release.HTMLURL
+		if notesLink == "" {
+			notesLink = fmt.Sprintf("https://%s/releases/tag/%s", h.conf.Github.RepoURL(), release.TagName())
+		}
+
+		version := strings.TrimPrefix(release.Version, "v")
+		item := &appcastItem{
+			Title:              "Version " + version,
+			PubDate:            release.PubDate.Format(time.RFC1123Z),
+			Version:            version,
+			ShortVersionString: version,
+			ReleaseNotesLink:   notesLink,
+			Enclosure: &appcastEnclosure{
+				URL:         downloadURL,
+				Length:      asset.Length,
+				Type:        "application/octet-stream",
+				EdSignature: release.Signature(asset),
+			},
+		}
+		if release.Meta != nil {
+			item.MinimumSystemVersion = release.Meta.MinimumSystemVersion
+		}
+		if channel := release.Channel(); channel != cache.StableChannel {
+			item.Channel = channel
+		}
+		return item
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/pkg/api"
+)
+
+// AppInstaller responses the `.appinstaller` update feed of MSIX packages.
+func (h *Handler) AppInstaller(c *gin.Context) {
+	release := h.cache.LoadCache()
+	if release == nil || release.AppInstaller == nil {
+		api.NoContent(c)
+		return
+	}
+
+	u, _ := url.Parse(h.conf.BaseURL)
+	u.Path = path.Join(u.Path, "appinstaller")
+	b := []byte(release.AppInstaller.WithFeedURL(u.String()))
+	c.Data(http.StatusOK, "application/appinstaller", b)
+}
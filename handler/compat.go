@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+	"github.com/panjiang/gohazel/pkg/api"
+)
+
+// electronPlatforms maps platforms of update.electronjs.org to aliases.
+var electronPlatforms = map[string]string{
+	"darwin":       "darwin",
+	"darwin-x64":   "darwin",
+	"darwin-arm64": "darwin",
+	"win32":        "win32",
+	"win32-x64":    "win32",
+	"win32-ia32":   "win32",
+	"win32-arm64":  "win32",
+}
+
+// nutsPlatforms maps platforms of Nuts to aliases.
+var nutsPlatforms = map[string]string{
+	"osx_64":       "mac",
+	"win_32":       "exe",
+	"win_64":       "exe",
+	"linux_32":     "AppImage",
+	"linux_64":     "AppImage",
+	"linux_deb_32": "deb",
+	"linux_deb_64": "deb",
+	"linux_rpm_32": "rpm",
+	"linux_rpm_64": "rpm",
+}
+
+// nutsPlatform resolves the Nuts platform if the Nuts routes are enabled.
+func (h *Handler) nutsPlatform(platform string) string {
+	if !h.conf.Compat.Nuts {
+		return platform
+	}
+	if p, ok := nutsPlatforms[platform]; ok {
+		return p
+	}
+	return platform
+}
+
+// Compat handles routes of other update servers which conflict with the native ones,
+// it's registered as the NoRoute handler:
+//
+//	/:owner/:repo/:platform/:version (update.electronjs.org)
+//	/:owner/:repo/:platform/:version/RELEASES (update.electronjs.org)
+//	/download/channel/:channel/:platform (Nuts)
+func (h *Handler) Compat(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		api.NotFound(c)
+		return
+	}
+
+	segments := strings.Split(strings.Trim(c.Request.URL.Path, "/"), "/")
+	switch {
+	case h.conf.Compat.Nuts && len(segments) == 4 && segments[0] == "download" && segments[1] == "channel":
+		h.downloadChannel(c, segments[2], segments[3])
+	case h.conf.Compat.Electron && (len(segments) == 4 || len(segments) == 5 && segments[4] == "RELEASES"):
+		h.electronUpdate(c, segments)
+	default:
+		api.NotFound(c)
+	}
+}
+
+// electronUpdate serves update.electronjs.org requests with the update handlers.
+func (h *Handler) electronUpdate(c *gin.Context, segments []string) {
+	if !strings.EqualFold(segments[0], h.conf.Github.Owner) || !strings.EqualFold(segments[1], h.conf.Github.Repo) {
+		api.NotFound(c)
+		return
+	}
+
+	platform, ok := electronPlatforms[segments[2]]
+	if !ok {
+		api.BadRequest(c, "platform", "")
+		return
+	}
+
+	c.Params = gin.Params{
+		{Key: "platform", Value: platform},
+		{Key: "version", Value: segments[3]},
+	}
+	if len(segments) == 5 {
+		h.Releases(c)
+		return
+	}
+	h.Update(c)
+}
+
+// channelRelease finds the latest release of the channel, which also contains stable releases.
+func (h *Handler) channelRelease(channel string) *cache.Release {
+	for _, release := range h.cache.LoadReleases() {
+		if c := release.Channel(); c == cache.StableChannel || c == channel {
+			return release
+		}
+	}
+	return nil
+}
+
+// downloadChannel responses the download of the latest release in channel.
+func (h *Handler) downloadChannel(c *gin.Context, channel string, platform string) {
+	platform, ok := h.resolvePlatform(platform, false)
+	if !ok {
+		api.BadRequest(c, "platform", "")
+		return
+	}
+
+	release := h.channelRelease(channel)
+	if release == nil {
+		api.NoContent(c)
+		return
+	}
+
+	asset, ok := release.Platforms[platform]
+	if !ok {
+		api.NoContent(c)
+		return
+	}
+	h.downloadAsset(c, release, asset)
+}
+
+// Versions responses releases in history like `/api/versions` of Nuts.
+func (h *Handler) Versions(c *gin.Context) {
+	channel := c.Query("channel")
+	versions := []gin.H{}
+	for _, release := range h.cache.LoadReleases() {
+		if channel != "" && channel != "*" && release.Channel() != channel {
+			continue
+		}
+
+		platforms := []gin.H{}
+		for platform, asset := range release.Platforms {
+			u, _ := url.Parse(h.conf.BaseURL)
+			u.Path = path.Join(u.Path, "download", platform, release.Version)
+			platforms = append(platforms, gin.H{
+				"type":         platform,
+				"filename":     asset.Name,
+				"size":         asset.Length,
+				"content_type": asset.ContentType,
+				"download_url": u.String(),
+			})
+		}
+
+		versions = append(versions, gin.H{
+			"tag":          release.Version,
+			"channel":      release.Channel(),
+			"notes":        release.Notes,
+			"published_at": release.PubDate.Format(time.RFC3339),
+			"platforms":    platforms,
+		})
+	}
+	c.JSON(http.StatusOK, versions)
+}
+
+// Notes responses the release notes of version, or the latest release by `latest`.
+func (h *Handler) Notes(c *gin.Context) {
+	var release *cache.Release
+	if version := c.Param("version"); version == "latest" {
+		release = h.cache.LoadCache()
+		if release == nil {
+			api.NoContent(c)
+			return
+		}
+	} else {
+		var ok bool
+		if release, ok = h.findRelease(c, version); !ok {
+			return
+		}
+	}
+
+	if c.NegotiateFormat(gin.MIMEPlain, gin.MIMEJSON) == gin.MIMEJSON {
+		api.Ok(c, gin.H{
+			"version":  release.Version,
+			"notes":    release.Notes,
+			"pub_date": release.PubDate,
+		})
+		return
+	}
+	c.String(http.StatusOK, release.Notes)
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/avct/uasurfer"
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+)
+
+// Operating systems of visitors.
+const (
+	osMac      = "mac"
+	osWindows  = "windows"
+	osLinux    = "linux"
+	osChromeOS = "chromeos"
+)
+
+// linuxDistros maps distribution tokens in user agent to package formats.
+var linuxDistros = []struct {
+	token  string
+	format string
+}{
+	{"ubuntu", "deb"},
+	{"debian", "deb"},
+	{"mint", "deb"},
+	{"elementary", "deb"},
+	{"pop!_os", "deb"},
+	{"raspbian", "deb"},
+	{"fedora", "rpm"},
+	{"red hat", "rpm"},
+	{"rhel", "rpm"},
+	{"centos", "rpm"},
+	{"rocky", "rpm"},
+	{"almalinux", "rpm"},
+	{"suse", "rpm"},
+	{"mageia", "rpm"},
+}
+
+// clientHint gets the unquoted value of a client hint header, e.g. `Sec-CH-UA-Platform: "Linux"`.
+func clientHint(c *gin.Context, name string) string {
+	return strings.Trim(c.GetHeader(name), `"`)
+}
+
+// detectOS parses visitor's OS from client hints or user agent.
+func detectOS(c *gin.Context) string {
+	switch strings.ToLower(clientHint(c, "Sec-CH-UA-Platform")) {
+	case "macos":
+		return osMac
+	case "windows":
+		return osWindows
+	case "linux":
+		return osLinux
+	case "chrome os", "chromium os":
+		return osChromeOS
+	case "":
+	default:
+		return ""
+	}
+
+	userAgent := uasurfer.Parse(c.Request.UserAgent())
+	switch userAgent.OS.Platform {
+	case uasurfer.PlatformMac:
+		return osMac
+	case uasurfer.PlatformWindows:
+		return osWindows
+	case uasurfer.PlatformLinux:
+		switch userAgent.OS.Name {
+		case uasurfer.OSLinux:
+			return osLinux
+		case uasurfer.OSChromeOS:
+			return osChromeOS
+		}
+	}
+	return ""
+}
+
+// detectArch parses visitor's CPU arch from client hints or user agent,
+// returns empty string for x86 or unknown.
+func detectArch(c *gin.Context) string {
+	switch strings.ToLower(clientHint(c, "Sec-CH-UA-Arch")) {
+	case "arm":
+		if clientHint(c, "Sec-CH-UA-Bitness") == "32" {
+			return "armv7l"
+		}
+		return "arm64"
+	case "x86":
+		return ""
+	}
+
+	ua := strings.ToLower(c.Request.UserAgent())
+	switch {
+	case strings.Contains(ua, "aarch64") || strings.Contains(ua, "arm64"):
+		return "arm64"
+	case strings.Contains(ua, "armv7") || strings.Contains(ua, "armv8l"):
+		return "armv7l"
+	}
+	return ""
+}
+
+// detectLinuxFormats returns package formats in order of preference for the distribution.
+func detectLinuxFormats(c *gin.Context, osName string) []string {
+	if osName == osChromeOS {
+		// Linux on ChromeOS runs a Debian container.
+		return []string{"deb", "AppImage", "tar.gz"}
+	}
+
+	ua := strings.ToLower(c.Request.UserAgent())
+	for _, distro := range linuxDistros {
+		if strings.Contains(ua, distro.token) {
+			return []string{distro.format, "AppImage", "snap", "tar.gz"}
+		}
+	}
+	return []string{"AppImage", "deb", "rpm", "snap", "tar.gz"}
+}
+
+// detectPlatforms parses the platforms in order of preference from
+// `?format=`, client hints and user agent, returns empty if it's not supported.
+func (h *Handler) detectPlatforms(c *gin.Context, isUpdate bool) []string {
+	arch := detectArch(c)
+	if format := c.Query("format"); format != "" {
+		platform, ok := h.resolvePlatform(format, isUpdate)
+		if !ok {
+			return nil
+		}
+		return []string{cache.WithArch(platform, arch)}
+	}
+
+	osName := detectOS(c)
+	switch osName {
+	case osMac:
+		if isUpdate {
+			return []string{"darwin"}
+		}
+		return []string{"dmg", "pkg"}
+	case osWindows:
+		return []string{"exe", "msi", "msix"}
+	case osLinux, osChromeOS:
+		formats := detectLinuxFormats(c, osName)
+		platforms := make([]string, 0, len(formats))
+		for _, format := range formats {
+			platforms = append(platforms, cache.WithArch(format, arch))
+		}
+		return platforms
+	}
+	return nil
+}
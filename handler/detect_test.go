@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectPlatforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		uri       string
+		userAgent string
+		headers   map[string]string
+		platforms []string
+	}{
+		{
+			name:      "windows",
+			uri:       "/download",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.111 Safari/537.36",
+			platforms: []string{"exe", "msi", "msix"},
+		},
+		{
+			name:      "mac update",
+			uri:       "/download?update=true",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.111 Safari/537.36",
+			platforms: []string{"darwin"},
+		},
+		{
+			name:      "ubuntu",
+			uri:       "/download",
+			userAgent: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:82.0) Gecko/20100101 Firefox/82.0",
+			platforms: []string{"deb", "AppImage", "snap", "tar.gz"},
+		},
+		{
+			name:      "fedora",
+			uri:       "/download",
+			userAgent: "Mozilla/5.0 (X11; Fedora; Linux x86_64; rv:82.0) Gecko/20100101 Firefox/82.0",
+			platforms: []string{"rpm", "AppImage", "snap", "tar.gz"},
+		},
+		{
+			name:      "linux",
+			uri:       "/download",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.111 Safari/537.36",
+			platforms: []string{"AppImage", "deb", "rpm", "snap", "tar.gz"},
+		},
+		{
+			name:      "linux arm64",
+			uri:       "/download",
+			userAgent: "Mozilla/5.0 (X11; Linux aarch64; rv:82.0) Gecko/20100101 Firefox/82.0",
+			platforms: []string{"AppImage-arm64", "deb-arm64", "rpm-arm64", "snap-arm64", "tar.gz-arm64"},
+		},
+		{
+			name:      "chromeos",
+			uri:       "/download",
+			userAgent: "Mozilla/5.0 (X11; CrOS x86_64 13421.89.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.112 Safari/537.36",
+			platforms: []string{"deb", "AppImage", "tar.gz"},
+		},
+		{
+			name:      "client hints",
+			uri:       "/download",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.111 Safari/537.36",
+			headers:   map[string]string{"Sec-CH-UA-Platform": `"Chrome OS"`, "Sec-CH-UA-Arch": `"arm"`},
+			platforms: []string{"deb-arm64", "AppImage-arm64", "tar.gz-arm64"},
+		},
+		{
+			name:      "format override",
+			uri:       "/download?format=fedora",
+			userAgent: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:82.0) Gecko/20100101 Firefox/82.0",
+			platforms: []string{"rpm"},
+		},
+		{
+			name:      "android",
+			uri:       "/download",
+			userAgent: "Mozilla/5.0 (Linux; Android 10; Pixel 3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.110 Mobile Safari/537.36",
+			platforms: nil,
+		},
+	}
+
+	h := &Handler{conf: &config.Config{}}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", tt.uri, nil)
+		c.Request.Header.Set("User-Agent", tt.userAgent)
+		for k, v := range tt.headers {
+			c.Request.Header.Set(k, v)
+		}
+		isUpdate := c.Query("update") == "true"
+		assert.Equal(t, tt.platforms, h.detectPlatforms(c, isUpdate), tt.name)
+	}
+}
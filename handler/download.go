@@ -1,26 +1,35 @@
 package handler
 
 import (
+	"net/url"
+	"path"
 	"strconv"
+	"strings"
 
-	"github.com/avct/uasurfer"
 	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
 	"github.com/panjiang/gohazel/pkg/api"
+	"golang.org/x/mod/semver"
 )
 
-func (h *Handler) download(c *gin.Context, platform string) {
+// download responses the asset of the first available platform in latest release.
+func (h *Handler) download(c *gin.Context, platforms ...string) {
 	release := h.cache.LoadCache()
 	if release == nil {
 		api.NoContent(c)
 		return
 	}
 
-	asset, ok := release.Platforms[platform]
-	if !ok {
-		api.NoContent(c)
-		return
+	for _, platform := range platforms {
+		if asset, ok := release.Platforms[platform]; ok {
+			h.downloadAsset(c, release, asset)
+			return
+		}
 	}
+	api.NoContent(c)
+}
 
+func (h *Handler) downloadAsset(c *gin.Context, release *cache.Release, asset *cache.Asset) {
 	if h.conf.ProxyDownload {
 		h.proxyDownload(c, release, asset)
 		return
@@ -31,46 +40,112 @@ func (h *Handler) download(c *gin.Context, platform string) {
 	})
 }
 
+// versionDownloadURL returns the url downloading the asset of platform in release,
+// it goes through the versioned route so the asset is filled on demand.
+func (h *Handler) versionDownloadURL(platform string, release *cache.Release) string {
+	u, _ := url.Parse(h.conf.BaseURL)
+	u.Path = path.Join(u.Path, "download", platform, release.Version)
+	return u.String()
+}
+
+// findRelease finds the release of version in history,
+// responses 404 if it's unknown or 410 if it's blocked.
+func (h *Handler) findRelease(c *gin.Context, version string) (*cache.Release, bool) {
+	release, err := h.cache.FindRelease(version)
+	switch err {
+	case nil:
+		return release, true
+	case cache.ErrReleaseBlocked:
+		api.Gone(c)
+	default:
+		api.NotFound(c)
+	}
+	return nil, false
+}
+
+// resolvePlatform resolves platform alias in uri.
+func (h *Handler) resolvePlatform(platform string, isUpdate bool) (string, bool) {
+	platform = h.nutsPlatform(platform)
+	if platform == "mac" && !isUpdate {
+		platform = "dmg"
+	}
+	return h.checkAlias(platform)
+}
+
 // Download reponses the download location url for
 // the platform parsed from user agent.
 func (h *Handler) Download(c *gin.Context) {
-	userAgent := uasurfer.Parse(c.Request.UserAgent())
 	isUpdate, _ := strconv.ParseBool(c.Query("update"))
-	osPlatform := userAgent.OS.Platform
-
-	var platform string
-	switch osPlatform {
-	case uasurfer.PlatformMac:
-		if isUpdate {
-			platform = "darwin"
-		} else {
-			platform = "dmg"
+	if format := c.Query("format"); format != "" {
+		if _, ok := h.resolvePlatform(format, isUpdate); !ok {
+			api.BadRequest(c, "format", "accepted formats: "+strings.Join(h.acceptedFormats(), ", "))
+			return
 		}
-
-	case uasurfer.PlatformWindows:
-		platform = "exe"
-	default:
+	}
+	platforms := h.detectPlatforms(c, isUpdate)
+	if len(platforms) == 0 {
 		api.NoContent(c)
 		return
 	}
 
-	h.download(c, platform)
+	h.download(c, platforms...)
 }
 
 // DownloadPlatform get download with specific platform.
 func (h *Handler) DownloadPlatform(c *gin.Context) {
 	isUpdate, _ := strconv.ParseBool(c.Query("update"))
-	platform := c.Param("platform")
+	platform, ok := h.resolvePlatform(c.Param("platform"), isUpdate)
+	if !ok {
+		api.BadRequest(c, "platform", "")
+		return
+	}
 
-	if platform == "mac" && !isUpdate {
-		platform = "dmg"
+	h.download(c, platform)
+}
+
+// DownloadVersion get download of a specific version, handles both
+// `/download/:platform/:version` and `/download/:version/:filename`.
+func (h *Handler) DownloadVersion(c *gin.Context) {
+	isUpdate, _ := strconv.ParseBool(c.Query("update"))
+	if platform, ok := h.resolvePlatform(c.Param("platform"), isUpdate); ok {
+		h.downloadPlatformVersion(c, platform, c.Param("version"))
+		return
 	}
 
-	platform, ok := checkAlias(platform)
+	if semver.IsValid(ToSemver(c.Param("platform"))) {
+		h.downloadVersionFile(c, c.Param("platform"), c.Param("version"))
+		return
+	}
+
+	api.BadRequest(c, "platform", "")
+}
+
+func (h *Handler) downloadPlatformVersion(c *gin.Context, platform string, version string) {
+	release, ok := h.findRelease(c, version)
 	if !ok {
-		api.BadRequest(c, "platform", "")
 		return
 	}
 
-	h.download(c, platform)
+	asset, ok := release.Platforms[platform]
+	if !ok {
+		api.NotFound(c)
+		return
+	}
+
+	h.downloadAsset(c, release, asset)
+}
+
+func (h *Handler) downloadVersionFile(c *gin.Context, version string, filename string) {
+	release, ok := h.findRelease(c, version)
+	if !ok {
+		return
+	}
+
+	for _, asset := range release.Platforms {
+		if asset.Name == filename {
+			h.downloadAsset(c, release, asset)
+			return
+		}
+	}
+	api.NotFound(c)
 }
@@ -1,8 +1,15 @@
 package handler
 
 import (
+	"html/template"
+	"sort"
+	texttemplate "text/template"
+
+	"github.com/panjiang/gohazel/bundle"
 	"github.com/panjiang/gohazel/cache"
 	"github.com/panjiang/gohazel/config"
+	"github.com/panjiang/gohazel/patch"
+	"github.com/panjiang/gohazel/repo"
 )
 
 var aliases = map[string][]string{
@@ -12,6 +19,20 @@ var aliases = map[string][]string{
 	"rpm":      {"fedora"},
 	"AppImage": {"appimage"},
 	"dmg":      {"dmg"},
+	"msi":      {"windows-msi"},
+	"msix":     {"windows-msix", "msixbundle"},
+	"appx":     {"windows-appx", "appxbundle"},
+	"win-zip":  {"windows-zip"},
+	"pkg":      {"macos-pkg", "mac-pkg"},
+	"snap":     {"snapcraft"},
+	"tar.gz":   {"tarball", "linux-tar.gz"},
+
+	"deb-arm64":       {"debian-arm64"},
+	"rpm-arm64":       {"fedora-arm64"},
+	"AppImage-arm64":  {"appimage-arm64"},
+	"deb-armv7l":      {"debian-armv7l"},
+	"rpm-armv7l":      {"fedora-armv7l"},
+	"AppImage-armv7l": {"appimage-armv7l"},
 }
 
 func checkAlias(platform string) (string, bool) {
@@ -30,16 +51,63 @@ func checkAlias(platform string) (string, bool) {
 	return "", false
 }
 
+// checkAlias resolves platform alias, also accepts targets of the platform rules.
+func (h *Handler) checkAlias(platform string) (string, bool) {
+	platform = h.nutsPlatform(platform)
+	if p, ok := checkAlias(platform); ok {
+		return p, true
+	}
+	_, ok := h.targets[platform]
+	return platform, ok
+}
+
+// acceptedFormats returns the sorted platforms and aliases accepted by `?format=`.
+func (h *Handler) acceptedFormats() []string {
+	formats := make([]string, 0, len(aliases)+len(h.targets))
+	for platform, names := range aliases {
+		formats = append(formats, platform)
+		formats = append(formats, names...)
+	}
+	for target := range h.targets {
+		if _, ok := aliases[target]; !ok {
+			formats = append(formats, target)
+		}
+	}
+	sort.Strings(formats)
+	return formats
+}
+
 // Handler handles requests of clients.
 type Handler struct {
-	cache *cache.GithubCache
-	conf  *config.Config
+	cache     *cache.GithubCache
+	conf      *config.Config
+	patcher   *patch.Patcher
+	nuget     *repo.Nuget
+	bundler   *bundle.Bundler
+	landing   *template.Template
+	manifests map[string]*texttemplate.Template
+	targets   map[string]struct{}
 }
 
 // NewHandler returns a handler instance.
-func NewHandler(conf *config.Config, cache *cache.GithubCache) *Handler {
-	return &Handler{
-		conf:  conf,
-		cache: cache,
+// The patcher, nuget and bundler are nil if they are disabled.
+func NewHandler(conf *config.Config, cache *cache.GithubCache, patcher *patch.Patcher, nuget *repo.Nuget, bundler *bundle.Bundler) *Handler {
+	h := &Handler{
+		conf:    conf,
+		cache:   cache,
+		patcher: patcher,
+		nuget:   nuget,
+		bundler: bundler,
+		targets: make(map[string]struct{}),
+	}
+	for _, target := range cache.PlatformTargets() {
+		h.targets[target] = struct{}{}
+	}
+	if conf.Landing.Enabled {
+		h.landing = newLandingTemplate(conf.Landing.TemplateDir)
+	}
+	if conf.Manifests.Enabled {
+		h.manifests = newManifestTemplates(conf.Manifests.TemplateDir)
 	}
+	return h
 }
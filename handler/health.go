@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/pkg/api"
+)
+
+// Health responses the service state, including the github api rate limit.
+func (h *Handler) Health(c *gin.Context) {
+	rateLimit := h.cache.RateLimit()
+	data := gin.H{
+		"status":      "ok",
+		"releases":    len(h.cache.LoadReleases()),
+		"rateLimit":   rateLimit,
+		"rateLimited": rateLimit.Wait(time.Now()) > 0,
+		"refresh":     h.cache.RefreshState(),
+	}
+	if latest := h.cache.LoadCache(); latest != nil {
+		data["version"] = latest.Version
+	}
+	api.Ok(c, data)
+}
+
+// Metrics responses metrics in Prometheus text format.
+func (h *Handler) Metrics(c *gin.Context) {
+	rateLimit := h.cache.RateLimit()
+	var buf bytes.Buffer
+	metric := func(name string, typ string, help string, value interface{}) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, value)
+	}
+	metric("gohazel_releases", "gauge", "Number of releases in history.", len(h.cache.LoadReleases()))
+	metric("gohazel_github_rate_limit", "gauge", "Github api rate limit per hour.", rateLimit.Limit)
+	metric("gohazel_github_rate_limit_remaining", "gauge", "Github api requests remaining in the current window.", rateLimit.Remaining)
+	metric("gohazel_github_rate_limit_reset_timestamp_seconds", "gauge", "Time the rate limit window resets.", unixTime(rateLimit.Reset))
+	metric("gohazel_github_retry_after_timestamp_seconds", "gauge", "Time requests are allowed after the secondary rate limit.", unixTime(rateLimit.RetryAfter))
+	metric("gohazel_github_requests_total", "counter", "Github api requests sent.", rateLimit.Requests)
+	metric("gohazel_github_not_modified_total", "counter", "Github api requests responded 304 Not Modified.", rateLimit.NotModified)
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+}
+
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
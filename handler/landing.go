@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+	"github.com/rs/zerolog/log"
+	"github.com/yuin/goldmark"
+)
+
+// LandingTemplateName is the file name of the landing page template
+// looked up in the template override directory.
+const LandingTemplateName = "index.html"
+
+// LandingStaticDir is the sub directory of the template override directory served at `/landing/`,
+// templates out of it are not served.
+const LandingStaticDir = "static"
+
+var platformLabels = map[string]string{
+	"darwin":    "macOS (zip)",
+	"dmg":       "macOS",
+	"exe":       "Windows",
+	"deb":       "Linux (deb)",
+	"rpm":       "Linux (rpm)",
+	"AppImage":  "Linux (AppImage)",
+	"msi":       "Windows (msi)",
+	"msix":      "Windows (msix)",
+	"appx":      "Windows (appx)",
+	"win-zip":   "Windows (zip)",
+	"pkg":       "macOS (pkg)",
+	"snap":      "Linux (snap)",
+	"tar.gz":    "Linux (tar.gz)",
+	"linux-zip": "Linux (zip)",
+
+	"deb-arm64":       "Linux ARM64 (deb)",
+	"rpm-arm64":       "Linux ARM64 (rpm)",
+	"AppImage-arm64":  "Linux ARM64 (AppImage)",
+	"deb-armv7l":      "Linux ARMv7 (deb)",
+	"rpm-armv7l":      "Linux ARMv7 (rpm)",
+	"AppImage-armv7l": "Linux ARMv7 (AppImage)",
+}
+
+func platformLabel(platform string) string {
+	if label, ok := platformLabels[platform]; ok {
+		return label
+	}
+	return platform
+}
+
+// landingAsset is an asset row rendered on the landing page.
+type landingAsset struct {
+	*cache.Asset
+	Platform    string
+	Label       string
+	DownloadURL string
+	Recommended bool
+}
+
+// landingData is the data passed to the landing page template.
+type landingData struct {
+	Title       string
+	Logo        string
+	Owner       string
+	Repo        string
+	Release     *cache.Release
+	Notes       template.HTML
+	Recommended *landingAsset
+	Assets      []*landingAsset
+}
+
+func newLandingTemplate(dir string) *template.Template {
+	tmpl := template.Must(template.New(LandingTemplateName).Parse(defaultLandingTemplate))
+	if dir == "" {
+		return tmpl
+	}
+
+	filename := filepath.Join(dir, LandingTemplateName)
+	custom, err := template.ParseFiles(filename)
+	if err != nil {
+		log.Error().Err(err).Str("file", filename).Msg("Parse landing template, use default")
+		return tmpl
+	}
+	log.Info().Str("file", filename).Msg("Loaded landing template")
+	return custom
+}
+
+func renderNotes(notes string) template.HTML {
+	var buf bytes.Buffer
+	if err := goldmark.Convert([]byte(notes), &buf); err != nil {
+		return template.HTML(template.HTMLEscapeString(notes))
+	}
+	return template.HTML(buf.String())
+}
+
+func (h *Handler) assetDownloadURL(release *cache.Release, asset *cache.Asset) string {
+	if h.conf.ProxyDownload {
+		return h.cache.AssetFileURL(release, asset.Name)
+	}
+	return asset.BrowserDownloadURL
+}
+
+// Landing renders the HTML download page of the latest release.
+func (h *Handler) Landing(c *gin.Context) {
+	data := &landingData{
+		Title: h.conf.Landing.Title,
+		Logo:  h.conf.Landing.Logo,
+		Owner: h.conf.Github.Owner,
+		Repo:  h.conf.Github.Repo,
+	}
+	if data.Title == "" {
+		data.Title = h.conf.Github.Repo
+	}
+
+	release := h.cache.LoadCache()
+	if release != nil {
+		data.Release = release
+		data.Notes = renderNotes(release.Notes)
+
+		var detected string
+		for _, platform := range h.detectPlatforms(c, false) {
+			if _, ok := release.Platforms[platform]; ok {
+				detected = platform
+				break
+			}
+		}
+		for platform, asset := range release.Platforms {
+			item := &landingAsset{
+				Asset:       asset,
+				Platform:    platform,
+				Label:       platformLabel(platform),
+				DownloadURL: h.assetDownloadURL(release, asset),
+				Recommended: platform == detected,
+			}
+			if item.Recommended {
+				data.Recommended = item
+			}
+			data.Assets = append(data.Assets, item)
+		}
+		sort.Slice(data.Assets, func(i, j int) bool {
+			return data.Assets[i].Label < data.Assets[j].Label
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := h.landing.Execute(&buf, data); err != nil {
+		log.Error().Err(err).Msg("Render landing page")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+const defaultLandingTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; color: #24292e; max-width: 760px; margin: 40px auto; padding: 0 16px; }
+header { text-align: center; margin-bottom: 32px; }
+header img { max-height: 96px; }
+.button { display: inline-block; padding: 12px 24px; border-radius: 6px; background: #2ea44f; color: #fff; text-decoration: none; font-weight: 600; }
+table { width: 100%; border-collapse: collapse; margin: 24px 0; }
+th, td { text-align: left; padding: 8px; border-bottom: 1px solid #e1e4e8; }
+tr.recommended { background: #f1f8ff; font-weight: 600; }
+.muted { color: #6a737d; }
+.notes { border-top: 1px solid #e1e4e8; margin-top: 24px; }
+</style>
+</head>
+<body>
+<header>
+{{if .Logo}}<img src="{{.Logo}}" alt="{{.Title}}">{{end}}
+<h1>{{.Title}}</h1>
+{{if .Release}}
+<p class="muted">{{.Release.Version}} &middot; {{.Release.PubDate.Format "2006-01-02"}}</p>
+{{if .Recommended}}<a class="button" href="{{.Recommended.DownloadURL}}">Download for {{.Recommended.Label}}</a>{{end}}
+{{else}}
+<p class="muted">No release available yet.</p>
+{{end}}
+</header>
+{{if .Release}}
+<table>
+<thead><tr><th>Platform</th><th>File</th><th>Size</th><th>Date</th></tr></thead>
+<tbody>
+{{range .Assets}}<tr{{if .Recommended}} class="recommended"{{end}}>
+<td>{{.Label}}</td>
+<td><a href="{{.DownloadURL}}">{{.Name}}</a></td>
+<td>{{.Size}} MB</td>
+<td>{{if not .UpdatedAt.IsZero}}{{.UpdatedAt.Format "2006-01-02"}}{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+<section class="notes">
+<h2>Release Notes</h2>
+{{.Notes}}
+</section>
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+	"github.com/panjiang/gohazel/pkg/api"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultManifestTemplates are package manager manifests by file name,
+// which can be overridden by files in the template directory.
+var defaultManifestTemplates = map[string]string{
+	"winget.yaml":           defaultWingetTemplate,
+	"homebrew.rb":           defaultHomebrewTemplate,
+	"chocolatey.nuspec":     defaultChocolateyNuspecTemplate,
+	"chocolateyinstall.ps1": defaultChocolateyInstallTemplate,
+}
+
+var manifestContentTypes = map[string]string{
+	".yaml":   "application/x-yaml",
+	".rb":     "text/plain; charset=utf-8",
+	".nuspec": "application/xml",
+	".ps1":    "text/plain; charset=utf-8",
+}
+
+const defaultWingetTemplate = `PackageIdentifier: {{ .ID }}
+PackageVersion: {{ .Version }}
+PackageLocale: en-US
+Publisher: {{ quote .Publisher }}
+PackageName: {{ quote .Name }}
+License: {{ quote .License }}
+ShortDescription: {{ quote .Description }}
+{{- with .Homepage }}
+PackageUrl: {{ . }}
+{{- end }}
+Installers:
+{{- with asset "exe" }}
+  - Architecture: x64
+    InstallerType: exe
+    InstallerUrl: {{ .URL }}
+    InstallerSha256: {{ .SHA256 }}
+    InstallerSwitches:
+      Silent: --silent
+      SilentWithProgress: --silent
+{{- end }}
+{{- with asset "msi" }}
+  - Architecture: x64
+    InstallerType: msi
+    InstallerUrl: {{ .URL }}
+    InstallerSha256: {{ .SHA256 }}
+{{- end }}
+{{- with asset "msix" }}
+  - Architecture: x64
+    InstallerType: msix
+    InstallerUrl: {{ .URL }}
+    InstallerSha256: {{ .SHA256 }}
+{{- end }}
+ManifestType: singleton
+ManifestVersion: 1.0.0
+`
+
+const defaultHomebrewTemplate = `cask "{{ lower .Repo }}" do
+{{- with or (asset "dmg") (asset "darwin") }}
+  version "{{ $.Version }}"
+  sha256 "{{ .SHA256 }}"
+
+  url "{{ .URL }}"
+{{- end }}
+  name {{ quote .Name }}
+  desc {{ quote .Description }}
+{{- with .Homepage }}
+  homepage "{{ . }}"
+{{- end }}
+
+  app "{{ .Name }}.app"
+end
+`
+
+const defaultChocolateyNuspecTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://schemas.microsoft.com/packaging/2015/06/nuspec.xsd">
+  <metadata>
+    <id>{{ xml (lower .Repo) }}</id>
+    <version>{{ xml .Version }}</version>
+    <title>{{ xml .Name }}</title>
+    <authors>{{ xml .Publisher }}</authors>
+{{- with .Homepage }}
+    <projectUrl>{{ xml . }}</projectUrl>
+{{- end }}
+    <description>{{ xml .Description }}</description>
+    <releaseNotes>{{ xml .Release.Notes }}</releaseNotes>
+  </metadata>
+  <files>
+    <file src="tools\**" target="tools" />
+  </files>
+</package>
+`
+
+const defaultChocolateyInstallTemplate = `$ErrorActionPreference = 'Stop'
+{{- with or (asset "msi") (asset "exe") }}
+
+$packageArgs = @{
+  packageName    = $env:ChocolateyPackageName
+{{- if eq .Platform "msi" }}
+  fileType       = 'msi'
+  silentArgs     = '/qn /norestart'
+{{- else }}
+  fileType       = 'exe'
+  silentArgs     = '--silent'
+{{- end }}
+  url64bit       = '{{ .URL }}'
+  checksum64     = '{{ .SHA256 }}'
+  checksumType64 = 'sha256'
+}
+
+Install-ChocolateyPackage @packageArgs
+{{- end }}
+`
+
+// manifestAsset is an asset with checksum rendered in manifests.
+type manifestAsset struct {
+	*cache.Asset
+	Platform string
+	URL      string
+	SHA256   string
+}
+
+// manifestData is the data passed to manifest templates.
+type manifestData struct {
+	ID          string
+	Name        string
+	Publisher   string
+	License     string
+	Description string
+	Homepage    string
+	Owner       string
+	Repo        string
+	Version     string
+	Release     *cache.Release
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func newManifestTemplates(dir string) map[string]*template.Template {
+	templates := make(map[string]*template.Template)
+	for name, text := range defaultManifestTemplates {
+		tmpl := template.Must(template.New(name).Funcs(manifestFuncs(nil)).Parse(text))
+		templates[name] = tmpl
+		if dir == "" {
+			continue
+		}
+
+		filename := filepath.Join(dir, name)
+		custom, err := template.New(name).Funcs(manifestFuncs(nil)).ParseFiles(filename)
+		if err != nil {
+			log.Debug().Err(err).Str("file", filename).Msg("Parse manifest template, use default")
+			continue
+		}
+		templates[name] = custom
+		log.Info().Str("file", filename).Msg("Loaded manifest template")
+	}
+	return templates
+}
+
+// manifestFuncs returns template funcs, `asset` looks up the asset of platform
+// in the release, and computes its checksum from the cached file.
+func manifestFuncs(asset func(platform string) (*manifestAsset, error)) template.FuncMap {
+	return template.FuncMap{
+		"asset": asset,
+		"quote": strconv.Quote,
+		"lower": strings.ToLower,
+		"xml":   xmlEscape,
+	}
+}
+
+// Manifest renders the package manager manifest for the latest release.
+func (h *Handler) Manifest(c *gin.Context) {
+	name := c.Param("file")
+	tmpl, ok := h.manifests[name]
+	if !ok {
+		api.NotFound(c)
+		return
+	}
+
+	release := h.cache.LoadCache()
+	if release == nil {
+		api.NoContent(c)
+		return
+	}
+
+	conf := h.conf.Manifests
+	data := &manifestData{
+		ID:          conf.ID,
+		Name:        conf.Name,
+		Publisher:   conf.Publisher,
+		License:     conf.License,
+		Description: conf.Description,
+		Homepage:    conf.Homepage,
+		Owner:       h.conf.Github.Owner,
+		Repo:        h.conf.Github.Repo,
+		Version:     strings.TrimPrefix(release.Version, "v"),
+		Release:     release,
+	}
+	if data.Name == "" {
+		data.Name = h.conf.Github.Repo
+	}
+	if data.Publisher == "" {
+		data.Publisher = h.conf.Github.Owner
+	}
+	if data.ID == "" {
+		data.ID = data.Publisher + "." + data.Name
+	}
+
+	asset := func(platform string) (*manifestAsset, error) {
+		a, ok := release.Platforms[platform]
+		if !ok {
+			return nil, nil
+		}
+		sum, err := h.cache.AssetSHA256(c.Request.Context(), release, a)
+		if err != nil {
+			return nil, err
+		}
+		return &manifestAsset{
+			Asset:    a,
+			Platform: platform,
+			URL:      h.assetDownloadURL(release, a),
+			SHA256:   sum,
+		}, nil
+	}
+
+	var buf bytes.Buffer
+	if err := template.Must(tmpl.Clone()).Funcs(manifestFuncs(asset)).Execute(&buf, data); err != nil {
+		log.Error().Err(err).Str("manifest", name).Msg("Render manifest")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, manifestContentTypes[filepath.Ext(name)], buf.Bytes())
+}
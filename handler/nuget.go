@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/pkg/api"
+	"github.com/panjiang/gohazel/repo"
+	"github.com/rs/zerolog/log"
+)
+
+const nugetServiceTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<service xml:base="{{ xml .Base }}" xmlns="http://www.w3.org/2007/app" xmlns:atom="http://www.w3.org/2005/Atom">
+  <workspace>
+    <atom:title>Default</atom:title>
+    <collection href="Packages">
+      <atom:title>Packages</atom:title>
+    </collection>
+  </workspace>
+</service>
+`
+
+const nugetMetadata = `<?xml version="1.0" encoding="utf-8"?>
+<edmx:Edmx Version="1.0" xmlns:edmx="http://schemas.microsoft.com/ado/2007/06/edmx">
+  <edmx:DataServices m:DataServiceVersion="2.0" m:MaxDataServiceVersion="2.0" xmlns:m="http://schemas.microsoft.com/ado/2007/08/dataservices/metadata">
+    <Schema Namespace="NuGetGallery.OData" xmlns="http://schemas.microsoft.com/ado/2006/04/edm">
+      <EntityType Name="V2FeedPackage" m:HasStream="true">
+        <Key>
+          <PropertyRef Name="Id" />
+          <PropertyRef Name="Version" />
+        </Key>
+        <Property Name="Id" Type="Edm.String" Nullable="false" />
+        <Property Name="Version" Type="Edm.String" Nullable="false" />
+        <Property Name="NormalizedVersion" Type="Edm.String" />
+        <Property Name="Authors" Type="Edm.String" />
+        <Property Name="Description" Type="Edm.String" />
+        <Property Name="IconUrl" Type="Edm.String" />
+        <Property Name="IsLatestVersion" Type="Edm.Boolean" Nullable="false" />
+        <Property Name="IsAbsoluteLatestVersion" Type="Edm.Boolean" Nullable="false" />
+        <Property Name="IsPrerelease" Type="Edm.Boolean" Nullable="false" />
+        <Property Name="PackageHash" Type="Edm.String" />
+        <Property Name="PackageHashAlgorithm" Type="Edm.String" />
+        <Property Name="PackageSize" Type="Edm.Int64" Nullable="false" />
+        <Property Name="ProjectUrl" Type="Edm.String" />
+        <Property Name="Published" Type="Edm.DateTime" Nullable="false" />
+        <Property Name="ReleaseNotes" Type="Edm.String" />
+        <Property Name="Summary" Type="Edm.String" />
+        <Property Name="Tags" Type="Edm.String" />
+        <Property Name="Title" Type="Edm.String" />
+        <Property Name="DownloadCount" Type="Edm.Int32" Nullable="false" />
+      </EntityType>
+      <EntityContainer Name="FeedContext_x0060_1" m:IsDefaultEntityContainer="true">
+        <EntitySet Name="Packages" EntityType="NuGetGallery.OData.V2FeedPackage" />
+        <FunctionImport Name="FindPackagesById" ReturnType="Collection(NuGetGallery.OData.V2FeedPackage)" EntitySet="Packages">
+          <Parameter Name="id" Type="Edm.String" FixedLength="false" Unicode="false" />
+        </FunctionImport>
+      </EntityContainer>
+    </Schema>
+  </edmx:DataServices>
+</edmx:Edmx>
+`
+
+const nugetFeedTemplate = `<?xml version="1.0" encoding="utf-8"?>
+{{- define "entry" }}
+  <entry{{ if .Root }} xml:base="{{ xml .Base }}" xmlns="http://www.w3.org/2005/Atom" xmlns:d="http://schemas.microsoft.com/ado/2007/08/dataservices" xmlns:m="http://schemas.microsoft.com/ado/2007/08/dataservices/metadata"{{ end }}>
+    <id>{{ xml .Base }}Packages(Id='{{ xml .ID }}',Version='{{ xml .Version }}')</id>
+    <category term="NuGetGallery.OData.V2FeedPackage" scheme="http://schemas.microsoft.com/ado/2007/08/dataservices/scheme" />
+    <link rel="edit" title="V2FeedPackage" href="Packages(Id='{{ xml .ID }}',Version='{{ xml .Version }}')" />
+    <title type="text">{{ xml .ID }}</title>
+    <summary type="text">{{ xml .Summary }}</summary>
+    <updated>{{ date .Published }}</updated>
+    <author><name>{{ xml .Authors }}</name></author>
+    <content type="application/zip" src="{{ xml .Base }}package/{{ xml .ID }}/{{ xml .Version }}" />
+    <m:properties>
+      <d:Id>{{ xml .ID }}</d:Id>
+      <d:Version>{{ xml .Version }}</d:Version>
+      <d:NormalizedVersion>{{ xml .Version }}</d:NormalizedVersion>
+      <d:Title>{{ xml .Title }}</d:Title>
+      <d:Authors>{{ xml .Authors }}</d:Authors>
+      <d:Description>{{ xml .Description }}</d:Description>
+      <d:Summary>{{ xml .Summary }}</d:Summary>
+      <d:ReleaseNotes>{{ xml .ReleaseNotes }}</d:ReleaseNotes>
+      <d:ProjectUrl>{{ xml .ProjectURL }}</d:ProjectUrl>
+      <d:IconUrl>{{ xml .IconURL }}</d:IconUrl>
+      <d:Tags>{{ xml .Tags }}</d:Tags>
+      <d:IsLatestVersion m:type="Edm.Boolean">{{ .IsLatestVersion }}</d:IsLatestVersion>
+      <d:IsAbsoluteLatestVersion m:type="Edm.Boolean">{{ .IsAbsoluteLatestVersion }}</d:IsAbsoluteLatestVersion>
+      <d:IsPrerelease m:type="Edm.Boolean">{{ .IsPrerelease }}</d:IsPrerelease>
+      <d:PackageHash>{{ .Hash }}</d:PackageHash>
+      <d:PackageHashAlgorithm>SHA512</d:PackageHashAlgorithm>
+      <d:PackageSize m:type="Edm.Int64">{{ .Size }}</d:PackageSize>
+      <d:Published m:type="Edm.DateTime">{{ date .Published }}</d:Published>
+      <d:DownloadCount m:type="Edm.Int32">0</d:DownloadCount>
+    </m:properties>
+  </entry>
+{{- end }}
+{{- if .Entry }}
+{{- template "entry" .Entry }}
+{{- else }}
+<feed xml:base="{{ xml .Base }}" xmlns="http://www.w3.org/2005/Atom" xmlns:d="http://schemas.microsoft.com/ado/2007/08/dataservices" xmlns:m="http://schemas.microsoft.com/ado/2007/08/dataservices/metadata">
+  <id>{{ xml .Base }}{{ .Title }}</id>
+  <title type="text">{{ .Title }}</title>
+  <updated>{{ date .Updated }}</updated>
+  <link rel="self" title="{{ .Title }}" href="{{ .Title }}" />
+{{- range .Entries }}
+{{- template "entry" . }}
+{{- end }}
+</feed>
+{{- end }}
+`
+
+var nugetTemplates = template.Must(template.New("service").Funcs(template.FuncMap{
+	"xml": xmlEscape,
+	"date": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02T15:04:05Z")
+	},
+}).Parse(nugetServiceTemplate))
+
+func init() {
+	template.Must(nugetTemplates.New("feed").Parse(nugetFeedTemplate))
+}
+
+var nugetPackageReg = regexp.MustCompile(`^Packages\(Id='([^']*)',Version='([^']*)'\)$`)
+
+// nugetEntry is a package entry rendered in feed.
+type nugetEntry struct {
+	*repo.NugetPackage
+	Base string
+	Root bool
+}
+
+// nugetFeed is the data passed to the feed template.
+type nugetFeed struct {
+	Base    string
+	Title   string
+	Updated time.Time
+	Entries []*nugetEntry
+	Entry   *nugetEntry
+}
+
+// Nuget serves the read-only NuGet v2 feed of cached Squirrel packages:
+//
+//	/nuget/
+//	/nuget/$metadata
+//	/nuget/Packages()
+//	/nuget/Packages(Id='id',Version='version')
+//	/nuget/FindPackagesById()?id='id'
+//	/nuget/package/:id/:version
+func (h *Handler) Nuget(c *gin.Context) {
+	u, _ := url.Parse(h.conf.BaseURL)
+	u.Path = path.Join(u.Path, "nuget") + "/"
+	base := u.String()
+
+	p := strings.Trim(c.Param("path"), "/")
+	switch {
+	case p == "":
+		h.renderNuget(c, "service", &nugetFeed{Base: base})
+	case p == "$metadata":
+		c.Data(http.StatusOK, "application/xml;charset=utf-8", []byte(nugetMetadata))
+	case p == "Packages" || p == "Packages()":
+		h.renderNugetFeed(c, base, "Packages", h.nuget.Packages(), c.Query("$filter"))
+	case p == "FindPackagesById()":
+		id := strings.Trim(c.Query("id"), "'")
+		h.renderNugetFeed(c, base, "FindPackagesById", h.nuget.FindPackages(id), c.Query("$filter"))
+	case nugetPackageReg.MatchString(p):
+		m := nugetPackageReg.FindStringSubmatch(p)
+		pkg := h.nuget.FindPackage(m[1], m[2])
+		if pkg == nil {
+			api.NotFound(c)
+			return
+		}
+		h.renderNuget(c, "feed", &nugetFeed{Entry: &nugetEntry{NugetPackage: pkg, Base: base, Root: true}})
+	case strings.HasPrefix(p, "package/"):
+		segments := strings.Split(p, "/")
+		if len(segments) != 3 {
+			api.NotFound(c)
+			return
+		}
+		pkg := h.nuget.FindPackage(segments[1], segments[2])
+		if pkg == nil {
+			api.NotFound(c)
+			return
+		}
+		c.FileAttachment(pkg.Path, pkg.ID+"."+pkg.Version+".nupkg")
+	default:
+		api.NotFound(c)
+	}
+}
+
+// renderNugetFeed renders packages, the filter only supports latest version checking.
+func (h *Handler) renderNugetFeed(c *gin.Context, base string, title string, packages []*repo.NugetPackage, filter string) {
+	feed := &nugetFeed{Base: base, Title: title, Updated: time.Now()}
+	absoluteLatest := strings.Contains(filter, "IsAbsoluteLatestVersion")
+	latestStable := strings.Contains(filter, "IsLatestVersion")
+	for _, pkg := range packages {
+		if (absoluteLatest && !pkg.IsAbsoluteLatestVersion) || (latestStable && !pkg.IsLatestVersion) {
+			continue
+		}
+		feed.Entries = append(feed.Entries, &nugetEntry{NugetPackage: pkg, Base: base})
+	}
+	h.renderNuget(c, "feed", feed)
+}
+
+func (h *Handler) renderNuget(c *gin.Context, name string, data *nugetFeed) {
+	var buf bytes.Buffer
+	if err := nugetTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Error().Err(err).Msg("Render NuGet feed")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	contentType := "application/atom+xml;type=feed;charset=utf-8"
+	if data.Entry != nil {
+		contentType = "application/atom+xml;type=entry;charset=utf-8"
+	} else if name == "service" {
+		contentType = "application/atomsvc+xml;charset=utf-8"
+	}
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
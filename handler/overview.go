@@ -5,8 +5,18 @@ import (
 	"github.com/panjiang/gohazel/pkg/api"
 )
 
-// Overview responses information of the latest version.
+// Overview responses the landing page for browsers if it's enabled,
+// otherwise information of the latest version.
 func (h *Handler) Overview(c *gin.Context) {
+	if h.landing != nil && c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		h.Landing(c)
+		return
+	}
+	h.OverviewJSON(c)
+}
+
+// OverviewJSON responses information of the latest version.
+func (h *Handler) OverviewJSON(c *gin.Context) {
 	latest := h.cache.LoadCache()
 	if latest == nil {
 		api.Ok(c, gin.H{
@@ -15,9 +25,20 @@ func (h *Handler) Overview(c *gin.Context) {
 		})
 		return
 	}
-	api.Ok(c, gin.H{
+	data := gin.H{
 		"owner":   h.conf.Github.Owner,
 		"repo":    h.conf.Github.Repo,
 		"release": latest,
-	})
+	}
+	if len(h.conf.Update.Lines) > 0 {
+		lines := gin.H{}
+		for i := range h.conf.Update.Lines {
+			line := &h.conf.Update.Lines[i]
+			if release := h.cache.LatestOf(line); release != nil {
+				lines[line.Name] = release.Version
+			}
+		}
+		data["lines"] = lines
+	}
+	api.Ok(c, data)
 }
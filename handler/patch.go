@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/url"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+	"github.com/panjiang/gohazel/patch"
+	"github.com/panjiang/gohazel/pkg/api"
+)
+
+// findPatch finds the generated patch between versions in history.
+func (h *Handler) findPatch(platform string, from string, to string) *patch.Patch {
+	if h.patcher == nil {
+		return nil
+	}
+	fromRelease, err := h.cache.FindRelease(from)
+	if err != nil {
+		return nil
+	}
+	toRelease, err := h.cache.FindRelease(to)
+	if err != nil {
+		return nil
+	}
+	return h.patcher.Find(platform, fromRelease.Version, toRelease.Version)
+}
+
+// patchInfo is the patch info in update response.
+func (h *Handler) patchInfo(p *patch.Patch) gin.H {
+	u, _ := url.Parse(h.conf.BaseURL)
+	u.Path = path.Join(u.Path, "patch", p.Platform, p.From, p.To)
+	return gin.H{
+		"url":           u.String(),
+		"size":          p.Size,
+		"sha256":        p.SHA256,
+		"target_sha256": p.TargetSHA256,
+	}
+}
+
+// Patch responses the binary delta patch of platform between versions.
+func (h *Handler) Patch(c *gin.Context) {
+	platform, ok := h.checkAlias(c.Param("platform"))
+	if !ok {
+		api.BadRequest(c, "platform", "")
+		return
+	}
+
+	from, to := c.Param("from"), c.Param("to")
+	if to == "latest" {
+		if latest := h.cache.LoadCache(); latest != nil {
+			to = latest.Version
+		}
+	}
+	if _, err := h.cache.FindRelease(from); err == cache.ErrReleaseBlocked {
+		api.Gone(c)
+		return
+	}
+
+	p := h.findPatch(platform, from, to)
+	if p == nil {
+		api.NotFound(c)
+		return
+	}
+	c.Header("X-Checksum-Sha256", p.SHA256)
+	c.FileAttachment(p.Path, path.Base(p.Path))
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"os"
 
 	"github.com/gin-gonic/gin"
@@ -13,13 +14,16 @@ func (h *Handler) proxyDownload(c *gin.Context, release *cache.Release, asset *c
 	assetPath := h.cache.AssetFilePath(release, asset.Name)
 	_, err := os.Stat(assetPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			log.Warn().Str("path", assetPath).Msg("Proxy download file lost")
+		if !os.IsNotExist(err) {
+			log.Error().Err(err).Msg("Stat asset path")
+			return
+		}
+		// Fill the cache for assets of older releases which are not downloaded ahead.
+		if err := h.cache.FillAsset(c.Request.Context(), release, asset); err != nil {
+			log.Warn().Err(err).Str("path", assetPath).Msg("Proxy download file lost")
 			api.NoContent(c)
 			return
 		}
-		log.Error().Err(err).Msg("Stat asset path")
-		return
 	}
 
 	location := h.cache.AssetFileURL(release, asset.Name)
@@ -27,3 +31,12 @@ func (h *Handler) proxyDownload(c *gin.Context, release *cache.Release, asset *c
 		"Location": location,
 	})
 }
+
+// filledAssetURL fills the asset of release and returns its url in cache dir, for
+// clients downloading the url directly without following the location in json.
+func (h *Handler) filledAssetURL(ctx context.Context, release *cache.Release, asset *cache.Asset) (string, error) {
+	if err := h.cache.FillAsset(ctx, release, asset); err != nil {
+		return "", err
+	}
+	return h.cache.AssetFileURL(release, asset.Name), nil
+}
@@ -14,7 +14,7 @@ func (h *Handler) Releases(c *gin.Context) {
 		return
 	}
 
-	release := h.cache.LoadCache()
+	release := h.updateRelease(c, ToSemver(c.Param("version")))
 	if release == nil {
 		api.NoContent(c)
 		return
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+	"github.com/panjiang/gohazel/pkg/api"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/mod/semver"
+)
+
+// tauriPlatforms maps Tauri `{{target}}-{{arch}}` to platforms in order of preference,
+// archives of Tauri v1 updater are preferred to the bundles Tauri v2 updates with.
+var tauriPlatforms = map[string][]string{
+	"darwin-x86_64":  {"darwin"},
+	"darwin-aarch64": {"darwin"},
+	"windows-x86_64": {"msi.zip", "nsis.zip", "msi", "exe", "win-zip"},
+	"windows-i686":   {"msi.zip", "nsis.zip", "msi", "exe", "win-zip"},
+	"linux-x86_64":   {"AppImage.tar.gz", "AppImage"},
+	"linux-aarch64":  {"AppImage.tar.gz-arm64", "AppImage-arm64"},
+	"linux-armv7":    {"AppImage.tar.gz-armv7l", "AppImage-armv7l"},
+}
+
+type tauriPlatform struct {
+	Signature string `json:"signature"`
+	URL       string `json:"url"`
+}
+
+// Tauri handles checking update request of Tauri updater.
+func (h *Handler) Tauri(c *gin.Context) {
+	target := c.Param("target") + "-" + c.Param("arch")
+	version := ToSemver(c.Param("current_version"))
+
+	if !semver.IsValid(version) {
+		api.BadRequest(c, "current_version", "is not SemVer-compatible")
+		return
+	}
+
+	if _, ok := tauriPlatforms[target]; !ok {
+		api.BadRequest(c, "target", "")
+		return
+	}
+
+	release := h.updateRelease(c, version)
+	if release == nil || semver.Compare(version, ToSemver(release.Version)) >= 0 {
+		api.NoContent(c)
+		return
+	}
+
+	platforms := map[string]*tauriPlatform{}
+	for name, candidates := range tauriPlatforms {
+		for _, platform := range candidates {
+			asset, ok := release.Platforms[platform]
+			if !ok {
+				continue
+			}
+			p, err := h.tauriPlatform(c.Request.Context(), release, asset)
+			if err != nil {
+				log.Warn().Err(err).Str("version", release.Version).Str("name", asset.Name).Msg("Fill tauri asset")
+				continue
+			}
+			platforms[name] = p
+			break
+		}
+	}
+
+	current, ok := platforms[target]
+	if !ok {
+		api.NoContent(c)
+		return
+	}
+
+	api.Ok(c, gin.H{
+		"version":   strings.TrimPrefix(release.Version, "v"),
+		"notes":     release.Notes,
+		"pub_date":  release.PubDate.Format(time.RFC3339),
+		"url":       current.URL,
+		"signature": current.Signature,
+		"platforms": platforms,
+	})
+}
+
+func (h *Handler) tauriPlatform(ctx context.Context, release *cache.Release, asset *cache.Asset) (*tauriPlatform, error) {
+	// The updater downloads the file directly, not following the location in json,
+	// so assets of releases in lines or stepping stones are filled ahead.
+	downloadURL := asset.BrowserDownloadURL
+	if h.conf.ProxyDownload {
+		var err error
+		downloadURL, err = h.filledAssetURL(ctx, release, asset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &tauriPlatform{
+		Signature: release.Signature(asset),
+		URL:       downloadURL,
+	}, nil
+}
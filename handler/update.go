@@ -2,14 +2,17 @@ package handler
 
 import (
 	"net/http"
-	"net/url"
-	"path"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
 	"github.com/panjiang/gohazel/pkg/api"
 	"golang.org/x/mod/semver"
 )
 
+// maxUpdatePath limits steps of the update path against misconfigured stepping stones.
+const maxUpdatePath = 20
+
 // Update handles checking update request.
 func (h *Handler) Update(c *gin.Context) {
 	h.update(c, false)
@@ -30,13 +33,13 @@ func (h *Handler) update(c *gin.Context, isYmL bool) {
 		return
 	}
 
-	platform, ok := checkAlias(platform)
+	platform, ok := h.checkAlias(platform)
 	if !ok {
 		api.BadRequest(c, "platform", "")
 		return
 	}
 
-	release := h.cache.LoadCache()
+	release := h.updateRelease(c, version)
 	if release == nil {
 		api.NoContent(c)
 		return
@@ -56,22 +59,21 @@ func (h *Handler) update(c *gin.Context, isYmL bool) {
 
 		var downloadURL string
 		if h.conf.ProxyDownload {
-			u, _ := url.Parse(h.conf.BaseURL)
-			u.Path = path.Join(u.Path, "download", platform)
-			q := u.Query()
-			q.Add("update", "true")
-			u.RawQuery = q.Encode()
-			downloadURL = u.String()
+			downloadURL = h.versionDownloadURL(platform, release)
 		} else {
 			downloadURL = asset.BrowserDownloadURL
 		}
 
-		api.Ok(c, gin.H{
+		data := gin.H{
 			"name":     release.Version,
 			"notes":    release.Notes,
 			"pub_data": release.PubDate,
 			"url":      downloadURL,
-		})
+		}
+		if p := h.findPatch(platform, version, release.Version); p != nil {
+			data["patch"] = h.patchInfo(p)
+		}
+		api.Ok(c, data)
 	} else {
 		// latest.yml
 		yml := asset.Yml
@@ -88,3 +90,46 @@ func (h *Handler) update(c *gin.Context, isYmL bool) {
 		}
 	}
 }
+
+// updateRelease returns the release the client of version updates to,
+// it opts in to a major upgrade by `allowMajor=true`.
+func (h *Handler) updateRelease(c *gin.Context, version string) *cache.Release {
+	allowMajor, _ := strconv.ParseBool(c.Query("allowMajor"))
+	return h.nextRelease(version, allowMajor)
+}
+
+// nextRelease returns the latest release of the client line by the update policy,
+// or the stepping stone before it. A client of the line without release in history
+// is offered the lowest newer line instead. It's nil if there is no one in history.
+func (h *Handler) nextRelease(version string, allowMajor bool) *cache.Release {
+	var release *cache.Release
+	if line := h.conf.Update.LineOf(version); line != nil && !allowMajor {
+		release = h.cache.LatestOf(line)
+		if release == nil {
+			release = h.cache.NextLineLatest(&h.conf.Update, version)
+		}
+	} else {
+		release = h.cache.LoadCache()
+	}
+	if release == nil {
+		return nil
+	}
+	if stone := h.conf.Update.NextStone(version, release.Version); stone != nil {
+		release, _ = h.cache.FindRelease(stone.Version)
+	}
+	return release
+}
+
+// updatePath returns versions the client of version updates through to the latest one.
+func (h *Handler) updatePath(version string, allowMajor bool) []string {
+	path := []string{}
+	for len(path) < maxUpdatePath {
+		release := h.nextRelease(version, allowMajor)
+		if release == nil || semver.Compare(ToSemver(release.Version), version) <= 0 {
+			break
+		}
+		version = ToSemver(release.Version)
+		path = append(path, release.Version)
+	}
+	return path
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/pkg/api"
+	"github.com/rs/zerolog/log"
+)
+
+// maxWebhookPayload limits the payload read before it's verified, github caps payloads at 25MB.
+const maxWebhookPayload = 25 << 20
+
+// GithubWebhook refreshes releases at once on release events of the repo webhook,
+// the payload is verified with `X-Hub-Signature-256` header signed by the webhook secret.
+func (h *Handler) GithubWebhook(c *gin.Context) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookPayload))
+	if err != nil {
+		api.BadRequest(c, "body", err.Error())
+		return
+	}
+	if !validWebhookSignature(h.conf.Github.WebhookSecret, body, c.GetHeader("X-Hub-Signature-256")) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	event := c.GetHeader("X-GitHub-Event")
+	switch event {
+	case "ping":
+		api.Ok(c, gin.H{"event": event})
+	case "release":
+		log.Info().Str("delivery", c.GetHeader("X-GitHub-Delivery")).Msg("Release webhook, refresh")
+		h.cache.Refresh()
+		c.JSON(http.StatusAccepted, gin.H{"event": event})
+	default:
+		api.NoContent(c)
+	}
+}
+
+func validWebhookSignature(secret string, body []byte, signature string) bool {
+	if secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGithubWebhook_MaxPayload(t *testing.T) {
+	conf := &config.Config{}
+	conf.Github.WebhookSecret = "webhook-secret"
+	h := &Handler{conf: conf}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body := bytes.Repeat([]byte("a"), maxWebhookPayload+1)
+	c.Request = httptest.NewRequest(http.MethodPost, "/webhook/github", bytes.NewReader(body))
+	h.GithubWebhook(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -1,27 +1,44 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
+	"github.com/panjiang/gohazel/bundle"
+	"github.com/panjiang/gohazel/cache"
 	"github.com/panjiang/gohazel/config"
 	"github.com/panjiang/gohazel/pkg/logger"
 	"github.com/panjiang/gohazel/server"
 	"github.com/rs/zerolog/log"
 )
 
-var usageStr = `Usage: gohazel [options]
+var usageStr = `Usage: gohazel [command] [options]
+Commands:
+    export            Export static files of update endpoints for the cached releases.
+    bundle export     Export a signed bundle of cached releases.
+    bundle import     Import a signed bundle into the cache.
+Export Options:
+    -out              Directory the static files are written to.
+Bundle Options:
+    -out              File the bundle is written to.
+    -in               File the bundle is read from.
+    -versions         Comma separated versions to bundle, default all in history.
 Server Options:
     -addr             Server listen address.
     -base_url         The server base URL.
     -debug            Open log debug level.
     -cache_dir        Cache files store in.
     -proxy_download   Proxy assets download with the server.
+    -keep_releases    Number of releases kept in history.
     -github_owner     Gihtub owner name.
     -github_repo      Github repository name.
     -github_token     Github api token for private repo.
+    -github_token_file File of the Github api token.
+    -landing          Serve the HTML download page at root.
     -config           Or specify a YAML configuration file.
 `
 
@@ -31,6 +48,15 @@ func usage() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		export(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 2 && os.Args[1] == "bundle" {
+		runBundle(os.Args[2], os.Args[3:])
+		return
+	}
+
 	fs := flag.NewFlagSet("gohazel", flag.ExitOnError)
 	fs.Usage = usage
 
@@ -47,3 +73,82 @@ func main() {
 	}
 	log.Info().Msg("Server closed")
 }
+
+// export writes static files of the cached releases without refreshing from github.
+func export(args []string) {
+	fs := flag.NewFlagSet("gohazel export", flag.ExitOnError)
+	fs.Usage = usage
+	out := fs.String("out", "export", "Directory the static files are written to.")
+
+	conf, err := config.Parse(fs, args)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	conf.Offline = true
+
+	logger.Setup(conf.Debug)
+
+	s := server.NewServer(conf)
+	defer s.Shutdown()
+	if err := s.Export(*out); err != nil {
+		log.Fatal().Err(err).Msg("Export")
+	}
+}
+
+// runBundle exports or imports bundles with the cached releases without refreshing from github.
+func runBundle(command string, args []string) {
+	fs := flag.NewFlagSet("gohazel bundle", flag.ExitOnError)
+	fs.Usage = usage
+	out := fs.String("out", "bundle.tar.gz", "File the bundle is written to.")
+	in := fs.String("in", "bundle.tar.gz", "File the bundle is read from.")
+	versions := fs.String("versions", "", "Comma separated versions to bundle, default all in history.")
+
+	conf, err := config.Parse(fs, args)
+	if err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	conf.Offline = true
+
+	logger.Setup(conf.Debug)
+
+	if !conf.ProxyDownload {
+		log.Fatal().Msg("Bundle should open proxyDownload")
+	}
+	c := cache.NewGithubCache(&conf.Github, conf.CacheOptions())
+	defer c.Stop()
+	bundler, err := bundle.NewBundler(&conf.Bundle, c, conf.Github.RepoURL(), conf.CacheURLBase())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Read bundle key")
+	}
+
+	switch command {
+	case "export":
+		var vs []string
+		if *versions != "" {
+			vs = strings.Split(*versions, ",")
+		}
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Create bundle")
+		}
+		if err := bundler.Export(context.Background(), f, vs); err != nil {
+			f.Close()
+			os.Remove(*out)
+			log.Fatal().Err(err).Msg("Export bundle")
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal().Err(err).Msg("Write bundle")
+		}
+	case "import":
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Open bundle")
+		}
+		defer f.Close()
+		if _, err := bundler.Import(context.Background(), f); err != nil {
+			log.Fatal().Err(err).Msg("Import bundle")
+		}
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,409 @@
+// Package patch generates binary delta patches between cached versions of assets.
+//
+// Patches use the bsdiff algorithm with the control, diff and extra blocks interleaved
+// like the ENDSLEY/BSDIFF43 layout, and the stream after the header is compressed with zstd
+// instead of bzip2. They have their own magic, as bsdiff tools can't apply them.
+package patch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const magic = "GOHAZEL/BSDIFFZ1"
+
+// ErrCorrupt is returned when applying a corrupt patch.
+var ErrCorrupt = errors.New("corrupt patch")
+
+// MaxApplySize is the max size in bytes of the new content Apply allocates,
+// patches declaring a larger one are corrupt.
+var MaxApplySize int64 = 1 << 30
+
+// checkEvery is the count of iterations between checks of context cancellation.
+const checkEvery = 1 << 16
+
+// Diff writes the patch which turns old into new, it stops when ctx is done.
+func Diff(ctx context.Context, old []byte, new []byte, w io.Writer) error {
+	header := make([]byte, len(magic)+8)
+	copy(header, magic)
+	putOff(header[len(magic):], int64(len(new)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(zw)
+	if err := diff(ctx, old, new, bw); err != nil {
+		zw.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// Apply reads the patch and returns the new content patched from old.
+func Apply(old []byte, patch io.Reader) ([]byte, error) {
+	header := make([]byte, len(magic)+8)
+	if _, err := io.ReadFull(patch, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrCorrupt
+	}
+	size := getOff(header[len(magic):])
+	if size < 0 || size > MaxApplySize {
+		return nil, ErrCorrupt
+	}
+
+	zr, err := zstd.NewReader(patch)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	r := bufio.NewReader(zr)
+
+	new := make([]byte, size)
+	ctrl := make([]byte, 24)
+	var oldPos, newPos int64
+	for newPos < size {
+		if _, err := io.ReadFull(r, ctrl); err != nil {
+			return nil, err
+		}
+		diffLen, extraLen, seek := getOff(ctrl[0:]), getOff(ctrl[8:]), getOff(ctrl[16:])
+		if diffLen < 0 || extraLen < 0 || newPos+diffLen > size {
+			return nil, ErrCorrupt
+		}
+
+		if _, err := io.ReadFull(r, new[newPos:newPos+diffLen]); err != nil {
+			return nil, err
+		}
+		for i := int64(0); i < diffLen; i++ {
+			if oldPos+i >= 0 && oldPos+i < int64(len(old)) {
+				new[newPos+i] += old[oldPos+i]
+			}
+		}
+		newPos += diffLen
+		oldPos += diffLen
+
+		if newPos+extraLen > size {
+			return nil, ErrCorrupt
+		}
+		if _, err := io.ReadFull(r, new[newPos:newPos+extraLen]); err != nil {
+			return nil, err
+		}
+		newPos += extraLen
+		oldPos += seek
+	}
+	return new, nil
+}
+
+// diff writes control, diff and extra blocks of the bsdiff algorithm.
+func diff(ctx context.Context, old []byte, new []byte, w io.Writer) error {
+	I, err := qsufsort(ctx, old)
+	if err != nil {
+		return err
+	}
+	oldSize, newSize := len(old), len(new)
+
+	ctrl := make([]byte, 24)
+	var buf []byte
+	var scan, pos, length int
+	var lastScan, lastPos, lastOffset int
+	for scan < newSize {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < newSize; scan++ {
+			if scan%checkEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			pos, length = search(I, old, new[scan:], 0, oldSize)
+
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < oldSize && old[scsc+lastOffset] == new[scsc] {
+					oldScore++
+				}
+			}
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+			if scan+lastOffset < oldSize && old[scan+lastOffset] == new[scan] {
+				oldScore--
+			}
+		}
+
+		if length == oldScore && scan != newSize {
+			continue
+		}
+
+		// Extend the match forward from the last one.
+		var s, sf, lenf int
+		for i := 0; lastScan+i < scan && lastPos+i < oldSize; {
+			if old[lastPos+i] == new[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenf {
+				sf, lenf = s, i
+			}
+		}
+
+		// Extend the next match backward.
+		lenb := 0
+		if scan < newSize {
+			var s, sb int
+			for i := 1; scan >= lastScan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenb {
+					sb, lenb = s, i
+				}
+			}
+		}
+
+		// Split the overlap.
+		if lastScan+lenf > scan-lenb {
+			overlap := (lastScan + lenf) - (scan - lenb)
+			var s, ss, lens int
+			for i := 0; i < overlap; i++ {
+				if new[lastScan+lenf-overlap+i] == old[lastPos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > ss {
+					ss, lens = s, i+1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		extraLen := (scan - lenb) - (lastScan + lenf)
+		putOff(ctrl[0:], int64(lenf))
+		putOff(ctrl[8:], int64(extraLen))
+		putOff(ctrl[16:], int64((pos-lenb)-(lastPos+lenf)))
+
+		buf = buf[:0]
+		buf = append(buf, ctrl...)
+		for i := 0; i < lenf; i++ {
+			buf = append(buf, new[lastScan+i]-old[lastPos+i])
+		}
+		buf = append(buf, new[lastScan+lenf:lastScan+lenf+extraLen]...)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+
+		lastScan = scan - lenb
+		lastPos = pos - lenb
+		lastOffset = pos - scan
+	}
+	return nil
+}
+
+// search finds the longest match of new in old with the suffix array.
+func search(I []int32, old []byte, new []byte, st int, en int) (int, int) {
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		p := int(I[x])
+		n := len(old) - p
+		if n > len(new) {
+			n = len(new)
+		}
+		if bytes.Compare(old[p:p+n], new[:n]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+
+	x := matchLen(old[I[st]:], new)
+	y := matchLen(old[I[en]:], new)
+	if x > y {
+		return int(I[st]), x
+	}
+	return int(I[en]), y
+}
+
+func matchLen(a []byte, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// qsufsort builds the suffix array of data with Larsson-Sadakane algorithm.
+func qsufsort(ctx context.Context, data []byte) ([]int32, error) {
+	n := len(data)
+	I := make([]int32, n+1)
+	V := make([]int32, n+1)
+
+	var buckets [256]int32
+	for _, b := range data {
+		buckets[b]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	for i, b := range data {
+		buckets[b]++
+		I[buckets[b]] = int32(i)
+	}
+	I[0] = int32(n)
+	for i, b := range data {
+		V[i] = buckets[b]
+	}
+	V[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := int32(1); I[0] != -int32(n+1); h += h {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var length int32
+		i := int32(0)
+		for i < int32(n+1) {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+				continue
+			}
+			if length != 0 {
+				I[i-length] = -length
+			}
+			length = V[I[i]] + 1 - i
+			split(I, V, i, length, h)
+			i += length
+			length = 0
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+
+	for i := 0; i < n+1; i++ {
+		I[V[i]] = int32(i)
+	}
+	return I, nil
+}
+
+func split(I []int32, V []int32, start int32, length int32, h int32) {
+	if length < 16 {
+		var j int32
+		for k := start; k < start+length; k += j {
+			j = 1
+			x := V[I[k]+h]
+			for i := int32(1); k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x = V[I[k+i]+h]
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := int32(0); i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	var jj, kk int32
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, int32(0), int32(0)
+	for i < jj {
+		switch {
+		case V[I[i]+h] < x:
+			i++
+		case V[I[i]+h] == x:
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		default:
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+	for i := int32(0); i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
+
+// putOff encodes the signed offset in sign-magnitude little endian.
+func putOff(b []byte, x int64) {
+	y := x
+	if y < 0 {
+		y = -y
+	}
+	binary.LittleEndian.PutUint64(b, uint64(y))
+	if x < 0 {
+		b[7] |= 0x80
+	}
+}
+
+func getOff(b []byte) int64 {
+	y := int64(binary.LittleEndian.Uint64(b) &^ (1 << 63))
+	if b[7]&0x80 != 0 {
+		y = -y
+	}
+	return y
+}
@@ -0,0 +1,74 @@
+package patch
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQsufsort(t *testing.T) {
+	data := []byte("mississippi banana bandana")
+	I, err := qsufsort(context.Background(), data)
+	require.NoError(t, err)
+	require.Len(t, I, len(data)+1)
+	assert.True(t, sort.SliceIsSorted(I, func(i, j int) bool {
+		return bytes.Compare(data[I[i]:], data[I[j]:]) < 0
+	}))
+}
+
+func TestDiffApply(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	old := make([]byte, 64*1024)
+	r.Read(old)
+
+	// Insert, modify and remove some blocks.
+	new := append([]byte{}, old[:10000]...)
+	new = append(new, []byte("inserted block")...)
+	new = append(new, old[10000:30000]...)
+	for i := 20000; i < 20100; i++ {
+		new[i]++
+	}
+	new = append(new, old[40000:]...)
+
+	tests := []struct {
+		name string
+		old  []byte
+		new  []byte
+	}{
+		{"modified", old, new},
+		{"same", old, old},
+		{"empty old", nil, new},
+		{"empty new", old, nil},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		require.NoError(t, Diff(context.Background(), tt.old, tt.new, &buf), tt.name)
+		if tt.name == "modified" {
+			assert.Less(t, buf.Len(), len(tt.new)/10, tt.name)
+		}
+
+		patched, err := Apply(tt.old, &buf)
+		require.NoError(t, err, tt.name)
+		assert.True(t, bytes.Equal(tt.new, patched), tt.name)
+	}
+
+	_, err := Apply(old, bytes.NewReader([]byte("ENDSLEY/BSDIFF43 of bsdiff tools")))
+	assert.Equal(t, ErrCorrupt, err)
+
+	// The size in header is checked before allocating.
+	header := make([]byte, len(magic)+8)
+	copy(header, magic)
+	putOff(header[len(magic):], MaxApplySize+1)
+	_, err = Apply(old, bytes.NewReader(header))
+	assert.Equal(t, ErrCorrupt, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, Diff(ctx, old, new, ioutil.Discard))
+}
@@ -0,0 +1,285 @@
+package patch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/rs/zerolog/log"
+)
+
+// Config of generating patches.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Platforms to generate patches for, default all.
+	Platforms []string `yaml:"platforms"`
+	// Depth is the count of previous releases to patch from, default 1.
+	Depth int `yaml:"depth"`
+	// MaxSize is the max size in bytes of assets to patch, default 256MB.
+	// Generating needs memory of about 10 times the asset size.
+	MaxSize int64 `yaml:"maxSize"`
+}
+
+const defaultMaxSize = 256 << 20
+
+// errTooLarge is returned for assets larger than the max size to patch.
+var errTooLarge = errors.New("exceeds the max size to patch")
+
+// Patch from an asset of a version to the one of another version.
+type Patch struct {
+	Platform string `json:"platform"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Path     string `json:"-"`
+	Size     int64  `json:"size"`
+	// SHA256 of the patch file.
+	SHA256 string `json:"sha256"`
+	// TargetSHA256 of the patched asset.
+	TargetSHA256 string `json:"targetSHA256"`
+}
+
+// Patcher generates patches to the latest release in background.
+type Patcher struct {
+	conf      *Config
+	cache     *cache.GithubCache
+	platforms map[string]struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	quitCh    chan struct{}
+	triggerCh chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.RWMutex
+	pending   []*cache.Release
+	patches   map[string]*Patch
+}
+
+// NewPatcher returns a patcher and starts its worker.
+func NewPatcher(conf *Config, c *cache.GithubCache) *Patcher {
+	if conf.Depth < 1 {
+		conf.Depth = 1
+	}
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = defaultMaxSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Patcher{
+		conf:      conf,
+		cache:     c,
+		platforms: make(map[string]struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		quitCh:    make(chan struct{}),
+		triggerCh: make(chan struct{}, 1),
+		patches:   make(map[string]*Patch),
+	}
+	for _, platform := range conf.Platforms {
+		p.platforms[platform] = struct{}{}
+	}
+
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+// Stop the worker, the generating patch is canceled.
+func (p *Patcher) Stop() {
+	p.cancel()
+	close(p.quitCh)
+	p.wg.Wait()
+}
+
+// Refresh is the cache refresh hook, patches are generated in background
+// until the patcher is stopped, instead of within the refresh.
+func (p *Patcher) Refresh(ctx context.Context, releases []*cache.Release) {
+	p.mu.Lock()
+	p.pending = releases
+	p.mu.Unlock()
+
+	select {
+	case p.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Patcher) run() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.quitCh:
+			return
+		case <-p.triggerCh:
+		}
+
+		p.mu.Lock()
+		releases := p.pending
+		p.pending = nil
+		p.mu.Unlock()
+
+		if err := p.Generate(releases); err != nil {
+			log.Error().Err(err).Msg("Generate patches")
+		}
+	}
+}
+
+func patchKey(platform string, from string, to string) string {
+	return platform + "/" + from + "/" + to
+}
+
+// Find the patch of the platform between versions in history.
+func (p *Patcher) Find(platform string, from string, to string) *Patch {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.patches[patchKey(platform, from, to)]
+}
+
+// Generate patches from previous releases to the latest one of each channel,
+// existing patch files are reused.
+func (p *Patcher) Generate(releases []*cache.Release) error {
+	patches := make(map[string]*Patch)
+	for _, latest := range cache.LatestOfChannels(releases) {
+		p.generateTo(latest, releases, patches)
+	}
+
+	p.mu.Lock()
+	p.patches = patches
+	p.mu.Unlock()
+	return nil
+}
+
+// generateTo generates patches to the release from the previous ones in history ordered by semver.
+func (p *Patcher) generateTo(latest *cache.Release, releases []*cache.Release, patches map[string]*Patch) {
+	var from []*cache.Release
+	for i, release := range releases {
+		if release == latest {
+			from = releases[i+1:]
+			break
+		}
+	}
+	if len(from) > p.conf.Depth {
+		from = from[:p.conf.Depth]
+	}
+
+	for platform, asset := range latest.Platforms {
+		if _, ok := p.platforms[platform]; len(p.platforms) > 0 && !ok {
+			continue
+		}
+		for _, release := range from {
+			fromAsset, ok := release.Platforms[platform]
+			if !ok {
+				continue
+			}
+			patch, err := p.generate(platform, release, fromAsset, latest, asset)
+			if errors.Is(err, errTooLarge) {
+				log.Info().Err(err).Str("platform", platform).Str("from", release.Version).Str("to", latest.Version).Msg("Skip patch")
+				continue
+			}
+			if err != nil {
+				log.Error().Err(err).Str("platform", platform).Str("from", release.Version).Str("to", latest.Version).Msg("Generate patch")
+				continue
+			}
+			patches[patchKey(platform, release.Version, latest.Version)] = patch
+		}
+	}
+}
+
+func (p *Patcher) generate(platform string, from *cache.Release, fromAsset *cache.Asset, to *cache.Release, toAsset *cache.Asset) (*Patch, error) {
+	if err := p.cache.FillAsset(p.ctx, from, fromAsset); err != nil {
+		return nil, err
+	}
+	if err := p.cache.FillAsset(p.ctx, to, toAsset); err != nil {
+		return nil, err
+	}
+
+	toPath := p.cache.AssetFilePath(to, toAsset.Name)
+	patchPath := p.cache.AssetFilePath(to, fmt.Sprintf("%s.%s.patch", toAsset.Name, from.Version))
+	if _, err := os.Stat(patchPath); os.IsNotExist(err) {
+		if err := diffFile(p.ctx, p.cache.AssetFilePath(from, fromAsset.Name), toPath, patchPath, p.conf.MaxSize); err != nil {
+			return nil, err
+		}
+	}
+
+	size, patchHash, err := hashFile(patchPath)
+	if err != nil {
+		return nil, err
+	}
+	_, targetHash, err := hashFile(toPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Patch{
+		Platform:     platform,
+		From:         from.Version,
+		To:           to.Version,
+		Path:         patchPath,
+		Size:         size,
+		SHA256:       patchHash,
+		TargetSHA256: targetHash,
+	}, nil
+}
+
+// diffFile writes the patch between files, which are read into memory with the suffix array
+// of the old one, so files larger than maxSize are refused.
+func diffFile(ctx context.Context, oldPath string, newPath string, patchPath string, maxSize int64) error {
+	for _, filename := range []string{oldPath, newPath} {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxSize {
+			return fmt.Errorf("%s of %d bytes %w %d", filepath.Base(filename), info.Size(), errTooLarge, maxSize)
+		}
+	}
+
+	old, err := ioutil.ReadFile(oldPath)
+	if err != nil {
+		return err
+	}
+	new, err := ioutil.ReadFile(newPath)
+	if err != nil {
+		return err
+	}
+
+	startAt := time.Now()
+	tmpPath := patchPath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := Diff(ctx, old, new, f); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, patchPath); err != nil {
+		return err
+	}
+	log.Info().Str("path", patchPath).Dur("duration", time.Since(startAt)).Msg("Generated patch")
+	return nil
+}
+
+func hashFile(filename string) (int64, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,73 @@
+package patch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatcher_Generate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-patch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &cache.GithubConfig{Owner: "panjiang", Repo: "gohazel-testing"}
+	newRelease := func(version string, content []byte) *cache.Release {
+		name := "App-Setup-" + version + ".exe"
+		filename := filepath.Join(dir, "panjiang", "gohazel-testing", version, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filename, content, 0644))
+		return &cache.Release{
+			Version:   version,
+			Platforms: map[string]*cache.Asset{"exe": {Name: name}},
+		}
+	}
+	old := bytes.Repeat([]byte("gohazel "), 4096)
+	new := append(append([]byte{}, old...), []byte("v1.1.0")...)
+	latest := newRelease("v1.1.0", new)
+	beta := newRelease("v1.2.0-beta.1", append(append([]byte{}, new...), []byte("-beta.1")...))
+	history := []*cache.Release{beta, latest, newRelease("v1.0.0", old), newRelease("v0.9.0", old[1024:])}
+	b, _ := json.Marshal(&cache.ReleaseData{Release: latest, History: history, RepoURL: conf.RepoURL(), ProxyDownload: true})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "release.json"), b, 0644))
+
+	c := cache.NewGithubCache(conf, &cache.Options{CacheDir: dir, ProxyDownload: true})
+	defer c.Stop()
+
+	small := NewPatcher(&Config{MaxSize: 1024}, c)
+	require.NoError(t, small.Generate(c.LoadReleases()))
+	small.Stop()
+	assert.Nil(t, small.Find("exe", "v1.0.0", "v1.1.0"), "too large")
+	_, err = os.Stat(filepath.Join(dir, "panjiang", "gohazel-testing", "v1.1.0", "App-Setup-v1.1.0.exe.v1.0.0.patch"))
+	assert.True(t, os.IsNotExist(err), "too large")
+	assetPath := c.AssetFilePath(latest, "App-Setup-v1.1.0.exe")
+	err = diffFile(context.Background(), assetPath, assetPath, assetPath+".patch", 1024)
+	assert.True(t, errors.Is(err, errTooLarge), "too large")
+
+	p := NewPatcher(&Config{}, c)
+	defer p.Stop()
+	require.NoError(t, p.Generate(c.LoadReleases()))
+
+	assert.Nil(t, p.Find("exe", "v0.9.0", "v1.1.0"), "out of depth")
+	assert.NotNil(t, p.Find("exe", "v1.1.0", "v1.2.0-beta.1"), "to the latest of beta channel")
+	patch := p.Find("exe", "v1.0.0", "v1.1.0")
+	require.NotNil(t, patch)
+	assert.FileExists(t, filepath.Join(dir, "panjiang", "gohazel-testing", "v1.1.0", "App-Setup-v1.1.0.exe.v1.0.0.patch"))
+
+	f, err := os.Open(patch.Path)
+	require.NoError(t, err)
+	defer f.Close()
+	patched, err := Apply(old, f)
+	require.NoError(t, err)
+	assert.Equal(t, new, patched)
+	_, targetHash, _ := hashFile(c.AssetFilePath(latest, "App-Setup-v1.1.0.exe"))
+	assert.Equal(t, targetHash, patch.TargetSHA256)
+}
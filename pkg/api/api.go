@@ -20,6 +20,11 @@ func NotFound(c *gin.Context) {
 	c.AbortWithStatus(http.StatusNotFound)
 }
 
+// Gone 410
+func Gone(c *gin.Context) {
+	c.AbortWithStatus(http.StatusGone)
+}
+
 // Found 302
 func Found(c *gin.Context, data gin.H) {
 	c.JSON(http.StatusFound, data)
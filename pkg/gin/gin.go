@@ -1,7 +1,10 @@
 package gin
 
 import (
+	"crypto/subtle"
+	"net/http"
 	"os"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 
@@ -32,3 +35,16 @@ func ginLogger() gin.HandlerFunc {
 		Logger: &subLog,
 	})
 }
+
+// TokenAuth checks the bearer token in `Authorization` header.
+func TokenAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
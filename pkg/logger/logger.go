@@ -1,14 +1,25 @@
 package logger
 
 import (
+	"io"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// Redacted replaces secrets in logs.
+const Redacted = "[REDACTED]"
+
+var (
+	secrets   []string
+	secretsMu sync.RWMutex
+)
+
 func init() {
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: &redactWriter{w: os.Stderr}})
 }
 
 // Setup initials with settings.
@@ -19,3 +30,47 @@ func Setup(debug bool) {
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
 }
+
+// AddSecret adds secrets to be redacted from logs, e.g. tokens loaded at runtime.
+func AddSecret(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		// Too short to be a secret, and redacting it breaks logs.
+		if len(v) < 4 {
+			continue
+		}
+		exist := false
+		for _, s := range secrets {
+			if s == v {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			secrets = append(secrets, v)
+		}
+	}
+}
+
+// Redact replaces added secrets in s.
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,245 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/rs/zerolog/log"
+)
+
+// AptConfig of the generated APT repository.
+type AptConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Suite     string `yaml:"suite"`
+	Component string `yaml:"component"`
+	Origin    string `yaml:"origin"`
+	Label     string `yaml:"label"`
+}
+
+// Apt generates APT repository from cached deb assets.
+type Apt struct {
+	conf   *AptConfig
+	cache  *cache.GithubCache
+	signer *Signer
+	dir    string
+	mu     sync.Mutex
+}
+
+// NewApt returns an APT repository generator writing into dir.
+func NewApt(conf *AptConfig, c *cache.GithubCache, signer *Signer, dir string) *Apt {
+	if conf.Suite == "" {
+		conf.Suite = "stable"
+	}
+	if conf.Component == "" {
+		conf.Component = "main"
+	}
+	return &Apt{
+		conf:   conf,
+		cache:  c,
+		signer: signer,
+		dir:    dir,
+	}
+}
+
+// Refresh is the cache refresh hook regenerating the repository.
+func (a *Apt) Refresh(ctx context.Context, releases []*cache.Release) {
+	if err := a.Generate(ctx, releases); err != nil {
+		log.Error().Err(err).Msg("Generate APT repository")
+	}
+}
+
+// Generate writes the repository of deb assets in releases, and replaces the old one.
+func (a *Apt) Generate(ctx context.Context, releases []*cache.Release) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tmpDir := a.dir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+
+	// Paragraphs of `Packages` by architecture.
+	packages := map[string][]string{}
+	var archAll []string
+	for _, release := range releases {
+		for platform, asset := range release.Platforms {
+			if !strings.HasPrefix(platform, "deb") {
+				continue
+			}
+			if err := a.cache.FillAsset(ctx, release, asset); err != nil {
+				log.Error().Err(err).Str("asset", asset.Name).Msg("Fill deb")
+				continue
+			}
+
+			assetPath := a.cache.AssetFilePath(release, asset.Name)
+			control, err := readDebControl(assetPath)
+			if err != nil {
+				log.Error().Err(err).Str("asset", asset.Name).Msg("Read deb control")
+				continue
+			}
+			name := control.Fields["Package"]
+			arch := control.Fields["Architecture"]
+			if name == "" || arch == "" {
+				log.Error().Str("asset", asset.Name).Msg("No package name or architecture in deb control")
+				continue
+			}
+
+			poolPath := path.Join("pool", a.conf.Component, poolPrefix(name), name, asset.Name)
+			if err := linkFile(assetPath, filepath.Join(tmpDir, poolPath)); err != nil {
+				return err
+			}
+			hashes, err := hashFile(assetPath)
+			if err != nil {
+				return err
+			}
+
+			paragraph := fmt.Sprintf("%s\nFilename: %s\nSize: %d\nMD5sum: %s\nSHA1: %s\nSHA256: %s\n",
+				control.Text, poolPath, hashes.Size, hashes.MD5, hashes.SHA1, hashes.SHA256)
+			if arch == "all" {
+				archAll = append(archAll, paragraph)
+				continue
+			}
+			packages[arch] = append(packages[arch], paragraph)
+		}
+	}
+	if len(packages) == 0 && len(archAll) > 0 {
+		packages["amd64"] = nil
+	}
+
+	archs := make([]string, 0, len(packages))
+	for arch := range packages {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+
+	distDir := filepath.Join(tmpDir, "dists", a.conf.Suite)
+	indexes := map[string]*fileHashes{}
+	for _, arch := range archs {
+		content := []byte(strings.Join(append(packages[arch], archAll...), "\n"))
+		binaryPath := path.Join(a.conf.Component, "binary-"+arch)
+		if err := a.writeIndex(distDir, path.Join(binaryPath, "Packages"), content, indexes); err != nil {
+			return err
+		}
+
+		gz, err := gzipBytes(content)
+		if err != nil {
+			return err
+		}
+		if err := a.writeIndex(distDir, path.Join(binaryPath, "Packages.gz"), gz, indexes); err != nil {
+			return err
+		}
+	}
+
+	release := a.releaseFile(archs, indexes)
+	if err := ioutil.WriteFile(filepath.Join(distDir, "Release"), release, 0644); err != nil {
+		return err
+	}
+	if err := a.sign(tmpDir, distDir, release); err != nil {
+		return err
+	}
+
+	if err := replaceDir(tmpDir, a.dir); err != nil {
+		return err
+	}
+	log.Info().Str("dir", a.dir).Strs("archs", archs).Msg("Generated APT repository")
+	return nil
+}
+
+// poolPrefix is the directory of the package in pool like Debian archives,
+// e.g. `c` of `crownote` and `libc` of `libcrown`.
+func poolPrefix(name string) string {
+	if strings.HasPrefix(name, "lib") && len(name) > 3 {
+		return name[:4]
+	}
+	return name[:1]
+}
+
+func (a *Apt) writeIndex(distDir string, name string, content []byte, indexes map[string]*fileHashes) error {
+	filename := filepath.Join(distDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+		return err
+	}
+	hashes, err := hashReader(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	indexes[name] = hashes
+	return nil
+}
+
+func (a *Apt) releaseFile(archs []string, indexes map[string]*fileHashes) []byte {
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	if a.conf.Origin != "" {
+		fmt.Fprintf(&buf, "Origin: %s\n", a.conf.Origin)
+	}
+	if a.conf.Label != "" {
+		fmt.Fprintf(&buf, "Label: %s\n", a.conf.Label)
+	}
+	fmt.Fprintf(&buf, "Suite: %s\n", a.conf.Suite)
+	fmt.Fprintf(&buf, "Codename: %s\n", a.conf.Suite)
+	fmt.Fprintf(&buf, "Date: %s\n", time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 UTC"))
+	fmt.Fprintf(&buf, "Architectures: %s\n", strings.Join(archs, " "))
+	fmt.Fprintf(&buf, "Components: %s\n", a.conf.Component)
+	for _, section := range []struct {
+		name string
+		hash func(h *fileHashes) string
+	}{
+		{"MD5Sum", func(h *fileHashes) string { return h.MD5 }},
+		{"SHA1", func(h *fileHashes) string { return h.SHA1 }},
+		{"SHA256", func(h *fileHashes) string { return h.SHA256 }},
+	} {
+		fmt.Fprintf(&buf, "%s:\n", section.name)
+		for _, name := range names {
+			fmt.Fprintf(&buf, " %s %d %s\n", section.hash(indexes[name]), indexes[name].Size, name)
+		}
+	}
+	return buf.Bytes()
+}
+
+func (a *Apt) sign(repoDir string, distDir string, release []byte) error {
+	if a.signer == nil {
+		log.Warn().Msg("No signing key, APT repository is unsigned")
+		return nil
+	}
+
+	inRelease, err := a.signer.ClearSign(release)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(distDir, "InRelease"), inRelease, 0644); err != nil {
+		return err
+	}
+
+	signature, err := a.signer.DetachSign(release)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(distDir, "Release.gpg"), signature, 0644); err != nil {
+		return err
+	}
+
+	publicKey, err := a.signer.PublicKey()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(repoDir, "key.asc"), publicKey, 0644)
+}
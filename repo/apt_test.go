@@ -0,0 +1,152 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+var testControl = `Package: crownote
+Version: 1.0.0
+Architecture: amd64
+Maintainer: panjiang
+Description: Crownote
+ Take notes.
+`
+
+// writeTestDeb writes a minimal deb package with control file.
+func writeTestDeb(t *testing.T, filename string, control string) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control))}))
+	tw.Write([]byte(control))
+	require.NoError(t, tw.Close())
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(tarBuf.Bytes())
+	require.NoError(t, zw.Close())
+
+	var buf bytes.Buffer
+	buf.WriteString(arMagic)
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", gz.Bytes()},
+		{"data.tar.gz", nil},
+	} {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.data))
+		buf.Write(member.data)
+		if len(member.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filename, buf.Bytes(), 0644))
+}
+
+// writeTestKey writes an armored private key for signing.
+func writeTestKey(t *testing.T, filename string) *openpgp.Entity {
+	entity, err := openpgp.NewEntity("gohazel", "test", "gohazel@example.com", nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(w, nil))
+	require.NoError(t, w.Close())
+	require.NoError(t, ioutil.WriteFile(filename, buf.Bytes(), 0600))
+	return entity
+}
+
+func TestReadDebControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-deb")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "crownote_1.0.0_amd64.deb")
+	writeTestDeb(t, filename, testControl)
+
+	control, err := readDebControl(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "crownote", control.Fields["Package"])
+	assert.Equal(t, "amd64", control.Fields["Architecture"])
+	assert.Equal(t, strings.TrimSpace(testControl), control.Text)
+}
+
+func TestPoolPrefix(t *testing.T) {
+	for name, prefix := range map[string]string{
+		"crownote": "c",
+		"libcrown": "libc",
+		"lib":      "l",
+		"x":        "x",
+	} {
+		assert.Equal(t, prefix, poolPrefix(name), name)
+	}
+}
+
+func TestApt_Generate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-apt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &cache.GithubConfig{Owner: "panjiang", Repo: "gohazel-testing"}
+	release := &cache.Release{
+		Version: "v1.0.0",
+		Platforms: map[string]*cache.Asset{
+			"deb": {Name: "crownote_1.0.0_amd64.deb"},
+		},
+	}
+	// The package of 0.9.0 fails to download.
+	failed := &cache.Release{Version: "v0.9.0", Platforms: map[string]*cache.Asset{"deb": {Name: "crownote_0.9.0_amd64.deb"}}}
+	history := []*cache.Release{release, failed}
+	b, _ := json.Marshal(&cache.ReleaseData{Release: release, History: history, RepoURL: conf.RepoURL(), ProxyDownload: true})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "release.json"), b, 0644))
+	writeTestDeb(t, filepath.Join(dir, "panjiang", "gohazel-testing", "v1.0.0", "crownote_1.0.0_amd64.deb"), testControl)
+
+	c := cache.NewGithubCache(conf, &cache.Options{CacheDir: dir, ProxyDownload: true})
+	defer c.Stop()
+
+	keyFile := filepath.Join(dir, "key.asc")
+	entity := writeTestKey(t, keyFile)
+	signer, err := NewSigner(&SigningConfig{KeyFile: keyFile})
+	require.NoError(t, err)
+
+	aptDir := filepath.Join(dir, "apt")
+	apt := NewApt(&AptConfig{}, c, signer, aptDir)
+	require.NoError(t, apt.Generate(context.Background(), c.LoadReleases()))
+
+	packages, err := ioutil.ReadFile(filepath.Join(aptDir, "dists", "stable", "main", "binary-amd64", "Packages"))
+	require.NoError(t, err)
+	assert.Contains(t, string(packages), "Package: crownote\n")
+	assert.Contains(t, string(packages), "Filename: pool/main/c/crownote/crownote_1.0.0_amd64.deb\n")
+	assert.NotContains(t, string(packages), "crownote_0.9.0_amd64.deb")
+	assert.FileExists(t, filepath.Join(aptDir, "pool", "main", "c", "crownote", "crownote_1.0.0_amd64.deb"))
+	assert.FileExists(t, filepath.Join(aptDir, "dists", "stable", "main", "binary-amd64", "Packages.gz"))
+	assert.FileExists(t, filepath.Join(aptDir, "key.asc"))
+
+	inRelease, err := ioutil.ReadFile(filepath.Join(aptDir, "dists", "stable", "InRelease"))
+	require.NoError(t, err)
+	block, _ := clearsign.Decode(inRelease)
+	require.NotNil(t, block)
+	assert.Contains(t, string(block.Plaintext), "main/binary-amd64/Packages.gz")
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	assert.NoError(t, err)
+}
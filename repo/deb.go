@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const arMagic = "!<arch>\n"
+
+// debControl is the parsed control file of deb package.
+type debControl struct {
+	Text   string
+	Fields map[string]string
+}
+
+// readDebControl reads the control file from `control.tar.*` member of the deb package.
+func readDebControl(filename string) (*debControl, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != arMagic {
+		return nil, errors.New("not a deb package")
+	}
+
+	header := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("no control member in deb package")
+			}
+			return nil, err
+		}
+		name := strings.TrimRight(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ar member size: %w", err)
+		}
+
+		if strings.HasPrefix(name, "control.tar") {
+			return readControlTar(io.LimitReader(r, size), path.Ext(name))
+		}
+
+		// Members are aligned to even offsets.
+		if _, err := io.CopyN(ioutil.Discard, r, size+size%2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readControlTar(r io.Reader, ext string) (*debControl, error) {
+	switch ext {
+	case ".gz":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	case ".xz":
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = xr
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case ".tar":
+	default:
+		return nil, fmt.Errorf("unsupported control compression %s", ext)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("no control file in deb package")
+			}
+			return nil, err
+		}
+		if path.Clean(h.Name) != "control" {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		return parseDebControl(b), nil
+	}
+}
+
+func parseDebControl(b []byte) *debControl {
+	text := strings.TrimSpace(string(bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))))
+	control := &debControl{
+		Text:   text,
+		Fields: make(map[string]string),
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		control.Fields[line[:i]] = strings.TrimSpace(line[i+1:])
+	}
+	return control
+}
@@ -0,0 +1,215 @@
+package repo
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/rs/zerolog/log"
+)
+
+// NugetConfig of the NuGet v2 feed.
+type NugetConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// NugetPackage is a package in NuGet feed.
+type NugetPackage struct {
+	ID           string
+	Version      string
+	Title        string
+	Authors      string
+	Description  string
+	Summary      string
+	ReleaseNotes string
+	ProjectURL   string
+	IconURL      string
+	Tags         string
+	Published    time.Time
+	Size         int64
+	// Hash is base64 encoded SHA512 of the package.
+	Hash string
+	Path string
+	// IsLatestVersion is the latest stable version of the package.
+	IsLatestVersion bool
+	// IsAbsoluteLatestVersion is the latest version including prereleases.
+	IsAbsoluteLatestVersion bool
+}
+
+// IsPrerelease checks if the version has prerelease label.
+func (p *NugetPackage) IsPrerelease() bool {
+	return strings.Contains(p.Version, "-")
+}
+
+// Nuget indexes cached Squirrel packages for a read-only NuGet v2 feed.
+type Nuget struct {
+	cache    *cache.GithubCache
+	mu       sync.RWMutex
+	packages []*NugetPackage
+}
+
+// NewNuget returns a NuGet feed of packages in the cache.
+func NewNuget(c *cache.GithubCache) *Nuget {
+	return &Nuget{cache: c}
+}
+
+// Refresh is the cache refresh hook indexing packages.
+func (n *Nuget) Refresh(ctx context.Context, releases []*cache.Release) {
+	if err := n.Generate(ctx, releases); err != nil {
+		log.Error().Err(err).Msg("Generate NuGet feed")
+	}
+}
+
+// Generate caches full packages of releases and reads their metadata,
+// delta packages are not listed.
+func (n *Nuget) Generate(ctx context.Context, releases []*cache.Release) error {
+	var packages []*NugetPackage
+	latest, latestStable := map[string]bool{}, map[string]bool{}
+	for _, release := range releases {
+		for _, asset := range release.Nupkgs {
+			if strings.HasSuffix(asset.Name, "-delta.nupkg") {
+				continue
+			}
+			if err := n.cache.FillAsset(ctx, release, asset); err != nil {
+				log.Error().Err(err).Str("asset", asset.Name).Msg("Fill nupkg")
+				continue
+			}
+
+			assetPath := n.cache.AssetFilePath(release, asset.Name)
+			pkg, err := readNupkg(assetPath)
+			if err != nil {
+				log.Error().Err(err).Str("asset", asset.Name).Msg("Read nupkg")
+				continue
+			}
+			pkg.Published = release.PubDate.Time
+			// Releases in history are ordered from the latest.
+			id := strings.ToLower(pkg.ID)
+			if !latest[id] {
+				latest[id] = true
+				pkg.IsAbsoluteLatestVersion = true
+			}
+			if !latestStable[id] && !pkg.IsPrerelease() {
+				latestStable[id] = true
+				pkg.IsLatestVersion = true
+			}
+			packages = append(packages, pkg)
+		}
+	}
+
+	n.mu.Lock()
+	n.packages = packages
+	n.mu.Unlock()
+	log.Info().Int("packages", len(packages)).Msg("Generated NuGet feed")
+	return nil
+}
+
+// Packages returns all packages in feed.
+func (n *Nuget) Packages() []*NugetPackage {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.packages
+}
+
+// FindPackages finds packages of the id, which is case insensitive.
+func (n *Nuget) FindPackages(id string) []*NugetPackage {
+	var packages []*NugetPackage
+	for _, pkg := range n.Packages() {
+		if strings.EqualFold(pkg.ID, id) {
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+// FindPackage finds the package of id and version.
+func (n *Nuget) FindPackage(id string, version string) *NugetPackage {
+	for _, pkg := range n.FindPackages(id) {
+		if strings.EqualFold(pkg.Version, version) {
+			return pkg
+		}
+	}
+	return nil
+}
+
+type nuspec struct {
+	Metadata struct {
+		ID           string `xml:"id"`
+		Version      string `xml:"version"`
+		Title        string `xml:"title"`
+		Authors      string `xml:"authors"`
+		Description  string `xml:"description"`
+		Summary      string `xml:"summary"`
+		ReleaseNotes string `xml:"releaseNotes"`
+		ProjectURL   string `xml:"projectUrl"`
+		IconURL      string `xml:"iconUrl"`
+		Tags         string `xml:"tags"`
+	} `xml:"metadata"`
+}
+
+// readNupkg reads the `.nuspec` metadata of nupkg.
+func readNupkg(filename string) (*NugetPackage, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var spec *nuspec
+	for _, f := range r.File {
+		if strings.Contains(f.Name, "/") || path.Ext(f.Name) != ".nuspec" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		spec = &nuspec{}
+		err = xml.NewDecoder(rc).Decode(spec)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if spec == nil || spec.Metadata.ID == "" || spec.Metadata.Version == "" {
+		return nil, errors.New("no nuspec in nupkg")
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha512.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+
+	m := spec.Metadata
+	return &NugetPackage{
+		ID:           m.ID,
+		Version:      m.Version,
+		Title:        m.Title,
+		Authors:      m.Authors,
+		Description:  m.Description,
+		Summary:      m.Summary,
+		ReleaseNotes: m.ReleaseNotes,
+		ProjectURL:   m.ProjectURL,
+		IconURL:      m.IconURL,
+		Tags:         m.Tags,
+		Size:         size,
+		Hash:         base64.StdEncoding.EncodeToString(h.Sum(nil)),
+		Path:         filename,
+	}, nil
+}
@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestNupkg writes a Squirrel package with nuspec.
+func writeTestNupkg(t *testing.T, filename string, id string, version string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), os.ModePerm))
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	w, err := zw.Create(id + ".nuspec")
+	require.NoError(t, err)
+	w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://schemas.microsoft.com/packaging/2010/07/nuspec.xsd">
+  <metadata>
+    <id>` + id + `</id>
+    <version>` + version + `</version>
+    <authors>GitHub</authors>
+    <description>A hackable text editor</description>
+  </metadata>
+</package>`))
+	w, err = zw.Create("lib/net45/" + id + ".exe")
+	require.NoError(t, err)
+	w.Write([]byte(version))
+	require.NoError(t, zw.Close())
+}
+
+func TestNuget_Generate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-nuget")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &cache.GithubConfig{Owner: "panjiang", Repo: "gohazel-testing"}
+	newRelease := func(version string) *cache.Release {
+		name := "atom-" + version + "-full.nupkg"
+		writeTestNupkg(t, filepath.Join(dir, "panjiang", "gohazel-testing", "v"+version, name), "atom", version)
+		return &cache.Release{
+			Version: "v" + version,
+			Nupkgs: []*cache.Asset{
+				{Name: name},
+				{Name: "atom-" + version + "-delta.nupkg"},
+			},
+		}
+	}
+	latest := newRelease("1.1.0")
+	// The package of 0.9.0 fails to download.
+	failed := &cache.Release{Version: "v0.9.0", Nupkgs: []*cache.Asset{{Name: "atom-0.9.0-full.nupkg"}}}
+	history := []*cache.Release{newRelease("1.2.0-beta.1"), latest, newRelease("1.0.0"), failed}
+	b, _ := json.Marshal(&cache.ReleaseData{Release: latest, History: history, RepoURL: conf.RepoURL(), ProxyDownload: true})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "release.json"), b, 0644))
+
+	c := cache.NewGithubCache(conf, &cache.Options{CacheDir: dir, ProxyDownload: true})
+	defer c.Stop()
+
+	nuget := NewNuget(c)
+	require.NoError(t, nuget.Generate(context.Background(), c.LoadReleases()))
+	require.Len(t, nuget.Packages(), 3)
+
+	pkg := nuget.FindPackage("Atom", "1.1.0")
+	require.NotNil(t, pkg)
+	assert.True(t, pkg.IsLatestVersion)
+	assert.False(t, pkg.IsAbsoluteLatestVersion)
+	assert.Equal(t, "GitHub", pkg.Authors)
+	assert.NotEmpty(t, pkg.Hash)
+	beta := nuget.FindPackage("atom", "1.2.0-beta.1")
+	assert.False(t, beta.IsLatestVersion)
+	assert.True(t, beta.IsAbsoluteLatestVersion)
+	assert.False(t, nuget.FindPackage("atom", "1.0.0").IsLatestVersion)
+}
@@ -0,0 +1,98 @@
+// Package repo generates package repositories and feeds from cached assets.
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fileHashes of the file listed in `Packages` and `Release`.
+type fileHashes struct {
+	Size   int64
+	MD5    string
+	SHA1   string
+	SHA256 string
+}
+
+func hashReader(r io.Reader) (*fileHashes, error) {
+	hMD5, hSHA1, hSHA256 := md5.New(), sha1.New(), sha256.New()
+	n, err := io.Copy(io.MultiWriter(hMD5, hSHA1, hSHA256), r)
+	if err != nil {
+		return nil, err
+	}
+	return &fileHashes{
+		Size:   n,
+		MD5:    hex.EncodeToString(hMD5.Sum(nil)),
+		SHA1:   hex.EncodeToString(hSHA1.Sum(nil)),
+		SHA256: hex.EncodeToString(hSHA256.Sum(nil)),
+	}, nil
+}
+
+func hashFile(filename string) (*fileHashes, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+// linkFile hard links the cached asset into repository, or copies it if linking is not supported.
+func linkFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// replaceDir replaces dir with the generated tmpDir, the old one is renamed aside first,
+// so dir is always there for serving.
+func replaceDir(tmpDir string, dir string) error {
+	oldDir := dir + ".old"
+	if err := os.RemoveAll(oldDir); err != nil {
+		return err
+	}
+	if err := os.Rename(dir, oldDir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		// Restore the old one.
+		os.Rename(oldDir, dir)
+		return err
+	}
+	return os.RemoveAll(oldDir)
+}
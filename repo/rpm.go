@@ -0,0 +1,374 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// RPM header tags used for repository metadata.
+const (
+	rpmTagName           = 1000
+	rpmTagVersion        = 1001
+	rpmTagRelease        = 1002
+	rpmTagEpoch          = 1003
+	rpmTagSummary        = 1004
+	rpmTagDescription    = 1005
+	rpmTagBuildTime      = 1006
+	rpmTagBuildHost      = 1007
+	rpmTagSize           = 1009
+	rpmTagVendor         = 1011
+	rpmTagLicense        = 1014
+	rpmTagPackager       = 1015
+	rpmTagGroup          = 1016
+	rpmTagURL            = 1020
+	rpmTagArch           = 1022
+	rpmTagFileModes      = 1030
+	rpmTagSourceRPM      = 1044
+	rpmTagProvideName    = 1047
+	rpmTagRequireFlags   = 1048
+	rpmTagRequireName    = 1049
+	rpmTagRequireVersion = 1050
+	rpmTagArchiveSize    = 1046
+	rpmTagProvideFlags   = 1112
+	rpmTagProvideVersion = 1113
+	rpmTagDirIndexes     = 1116
+	rpmTagBaseNames      = 1117
+	rpmTagDirNames       = 1118
+)
+
+// RPM header data types.
+const (
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeInt64       = 5
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// Dependency sense flags.
+const (
+	rpmSenseLess    = 1 << 1
+	rpmSenseGreater = 1 << 2
+	rpmSenseEqual   = 1 << 3
+)
+
+const rpmLeadSize = 96
+
+// Limits of header structures, the same as rpm checks.
+const (
+	rpmMaxIndexEntries = 0xffff
+	rpmMaxStoreSize    = 0x0fffffff
+)
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+type rpmIndexEntry struct {
+	Tag    int32
+	Type   int32
+	Offset int32
+	Count  int32
+}
+
+// rpmHeader is a parsed header structure of rpm package.
+type rpmHeader struct {
+	entries map[int32]rpmIndexEntry
+	store   []byte
+	// Size in bytes including the intro and index.
+	size int64
+}
+
+func readRPMHeader(r io.Reader) (*rpmHeader, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(intro[:4], rpmHeaderMagic) {
+		return nil, errors.New("invalid rpm header magic")
+	}
+	nindex := binary.BigEndian.Uint32(intro[8:12])
+	hsize := binary.BigEndian.Uint32(intro[12:16])
+	if nindex > rpmMaxIndexEntries || hsize > rpmMaxStoreSize {
+		return nil, fmt.Errorf("rpm header of %d entries and %d bytes is too large", nindex, hsize)
+	}
+
+	h := &rpmHeader{
+		entries: make(map[int32]rpmIndexEntry, nindex),
+		store:   make([]byte, hsize),
+		size:    16 + int64(nindex)*16 + int64(hsize),
+	}
+	for i := uint32(0); i < nindex; i++ {
+		var entry rpmIndexEntry
+		if err := binary.Read(r, binary.BigEndian, &entry); err != nil {
+			return nil, err
+		}
+		if entry.Offset < 0 || entry.Count < 0 || entry.Offset > int32(hsize) {
+			return nil, fmt.Errorf("invalid rpm header entry of tag %d", entry.Tag)
+		}
+		h.entries[entry.Tag] = entry
+	}
+	if _, err := io.ReadFull(r, h.store); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *rpmHeader) strings(tag int32) []string {
+	entry, ok := h.entries[tag]
+	if !ok {
+		return nil
+	}
+	switch entry.Type {
+	case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+	default:
+		return nil
+	}
+	if int(entry.Offset) > len(h.store) {
+		return nil
+	}
+
+	data := h.store[entry.Offset:]
+	var values []string
+	for i := int32(0); i < entry.Count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			break
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+		// I18N string table stores translations, the first is the default.
+		if entry.Type != rpmTypeStringArray {
+			break
+		}
+	}
+	return values
+}
+
+func (h *rpmHeader) string(tag int32) string {
+	values := h.strings(tag)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (h *rpmHeader) ints(tag int32) []int64 {
+	entry, ok := h.entries[tag]
+	if !ok {
+		return nil
+	}
+	size := map[int32]int{rpmTypeInt16: 2, rpmTypeInt32: 4, rpmTypeInt64: 8}[entry.Type]
+	if size == 0 || int(entry.Offset)+int(entry.Count)*size > len(h.store) {
+		return nil
+	}
+
+	values := make([]int64, entry.Count)
+	for i := range values {
+		b := h.store[int(entry.Offset)+i*size:]
+		switch size {
+		case 2:
+			values[i] = int64(binary.BigEndian.Uint16(b))
+		case 4:
+			values[i] = int64(binary.BigEndian.Uint32(b))
+		case 8:
+			values[i] = int64(binary.BigEndian.Uint64(b))
+		}
+	}
+	return values
+}
+
+func (h *rpmHeader) int(tag int32) int64 {
+	values := h.ints(tag)
+	if len(values) == 0 {
+		return 0
+	}
+	return values[0]
+}
+
+// rpmDependency is an entry of provides or requires.
+type rpmDependency struct {
+	Name    string
+	Flags   string
+	Epoch   string
+	Version string
+	Release string
+}
+
+// rpmPackage is the metadata of rpm package for repository.
+type rpmPackage struct {
+	Name        string
+	Epoch       string
+	Version     string
+	Release     string
+	Arch        string
+	Summary     string
+	Description string
+	Packager    string
+	URL         string
+	BuildTime   int64
+	BuildHost   string
+	License     string
+	Vendor      string
+	Group       string
+	SourceRPM   string
+	Size        int64
+	ArchiveSize int64
+	// Byte range of the main header in file.
+	HeaderStart int64
+	HeaderEnd   int64
+	Provides    []*rpmDependency
+	Requires    []*rpmDependency
+	Files       []*rpmFile
+}
+
+// rpmFile is a file or dir installed by the package.
+type rpmFile struct {
+	Path  string
+	IsDir bool
+}
+
+// readRPMPackage reads metadata from the headers of rpm package.
+func readRPMPackage(filename string) (*rpmPackage, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(r, lead); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(lead[:4], rpmLeadMagic) {
+		return nil, errors.New("not a rpm package")
+	}
+
+	signature, err := readRPMHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("read signature header: %w", err)
+	}
+	// The signature header is padded to 8 bytes.
+	if pad := (8 - signature.size%8) % 8; pad > 0 {
+		if _, err := r.Discard(int(pad)); err != nil {
+			return nil, err
+		}
+	}
+	start := rpmLeadSize + signature.size + (8-signature.size%8)%8
+
+	h, err := readRPMHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	pkg := &rpmPackage{
+		Name:        h.string(rpmTagName),
+		Version:     h.string(rpmTagVersion),
+		Release:     h.string(rpmTagRelease),
+		Arch:        h.string(rpmTagArch),
+		Summary:     h.string(rpmTagSummary),
+		Description: h.string(rpmTagDescription),
+		Packager:    h.string(rpmTagPackager),
+		URL:         h.string(rpmTagURL),
+		BuildTime:   h.int(rpmTagBuildTime),
+		BuildHost:   h.string(rpmTagBuildHost),
+		License:     h.string(rpmTagLicense),
+		Vendor:      h.string(rpmTagVendor),
+		Group:       h.string(rpmTagGroup),
+		SourceRPM:   h.string(rpmTagSourceRPM),
+		Size:        h.int(rpmTagSize),
+		ArchiveSize: h.int(rpmTagArchiveSize),
+		HeaderStart: start,
+		HeaderEnd:   start + h.size,
+	}
+	if pkg.Name == "" || pkg.Version == "" {
+		return nil, errors.New("no name or version in rpm header")
+	}
+	pkg.Epoch = "0"
+	if _, ok := h.entries[rpmTagEpoch]; ok {
+		pkg.Epoch = fmt.Sprint(h.int(rpmTagEpoch))
+	}
+
+	pkg.Provides = rpmDependencies(h, rpmTagProvideName, rpmTagProvideFlags, rpmTagProvideVersion)
+	for _, dep := range rpmDependencies(h, rpmTagRequireName, rpmTagRequireFlags, rpmTagRequireVersion) {
+		// Internal rpm features are not listed in repository metadata.
+		if strings.HasPrefix(dep.Name, "rpmlib(") {
+			continue
+		}
+		pkg.Requires = append(pkg.Requires, dep)
+	}
+
+	dirNames := h.strings(rpmTagDirNames)
+	dirIndexes := h.ints(rpmTagDirIndexes)
+	modes := h.ints(rpmTagFileModes)
+	for i, base := range h.strings(rpmTagBaseNames) {
+		if i >= len(dirIndexes) || int(dirIndexes[i]) >= len(dirNames) {
+			break
+		}
+		file := &rpmFile{Path: path.Join(dirNames[dirIndexes[i]], base)}
+		if i < len(modes) {
+			// S_IFDIR
+			file.IsDir = modes[i]&0170000 == 0040000
+		}
+		pkg.Files = append(pkg.Files, file)
+	}
+	return pkg, nil
+}
+
+func rpmDependencies(h *rpmHeader, nameTag, flagsTag, versionTag int32) []*rpmDependency {
+	names := h.strings(nameTag)
+	flags := h.ints(flagsTag)
+	versions := h.strings(versionTag)
+
+	deps := make([]*rpmDependency, 0, len(names))
+	for i, name := range names {
+		dep := &rpmDependency{Name: name}
+		if i < len(flags) {
+			dep.Flags = rpmSenseFlags(flags[i])
+		}
+		if i < len(versions) && versions[i] != "" {
+			dep.Epoch, dep.Version, dep.Release = splitEVR(versions[i])
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+func rpmSenseFlags(flags int64) string {
+	switch flags & (rpmSenseLess | rpmSenseGreater | rpmSenseEqual) {
+	case rpmSenseLess:
+		return "LT"
+	case rpmSenseGreater:
+		return "GT"
+	case rpmSenseEqual:
+		return "EQ"
+	case rpmSenseLess | rpmSenseEqual:
+		return "LE"
+	case rpmSenseGreater | rpmSenseEqual:
+		return "GE"
+	}
+	return ""
+}
+
+// splitEVR splits `epoch:version-release`.
+func splitEVR(evr string) (string, string, string) {
+	epoch := "0"
+	if i := strings.Index(evr, ":"); i >= 0 {
+		epoch, evr = evr[:i], evr[i+1:]
+	}
+	release := ""
+	if i := strings.LastIndex(evr, "-"); i >= 0 {
+		evr, release = evr[:i], evr[i+1:]
+	}
+	return epoch, evr, release
+}
@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// SigningConfig of the GPG key for signing repository metadata.
+type SigningConfig struct {
+	KeyFile    string `yaml:"keyFile"`
+	Passphrase string `yaml:"passphrase"`
+}
+
+// Signer signs repository metadata with GPG key.
+type Signer struct {
+	entity *openpgp.Entity
+}
+
+// NewSigner reads the armored private key, returns nil if no key is configured.
+func NewSigner(conf *SigningConfig) (*Signer, error) {
+	if conf.KeyFile == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(conf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entities, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, errors.New("no key in key file")
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey == nil {
+		return nil, errors.New("no private key in key file")
+	}
+	if entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt([]byte(conf.Passphrase)); err != nil {
+			return nil, err
+		}
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			if err := subkey.PrivateKey.Decrypt([]byte(conf.Passphrase)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &Signer{entity: entity}, nil
+}
+
+// ClearSign returns the clear signed message of data, e.g. `InRelease`.
+func (s *Signer) ClearSign(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := clearsign.Encode(&buf, s.entity.PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DetachSign returns the armored detached signature of data, e.g. `Release.gpg`.
+func (s *Signer) DetachSign(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, s.entity, bytes.NewReader(data), nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PublicKey returns the armored public key for clients to import.
+func (s *Signer) PublicKey() ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.entity.Serialize(w); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,425 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/rs/zerolog/log"
+)
+
+// YumConfig of the generated YUM/DNF repository.
+type YumConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Name    string `yaml:"name"`
+}
+
+// Yum generates YUM/DNF repository from cached rpm assets.
+type Yum struct {
+	conf    *YumConfig
+	cache   *cache.GithubCache
+	signer  *Signer
+	dir     string
+	baseURL string
+	mu      sync.Mutex
+}
+
+// NewYum returns a YUM repository generator writing into dir,
+// which is served at baseURL.
+func NewYum(conf *YumConfig, c *cache.GithubCache, signer *Signer, dir string, baseURL string) *Yum {
+	return &Yum{
+		conf:    conf,
+		cache:   c,
+		signer:  signer,
+		dir:     dir,
+		baseURL: baseURL,
+	}
+}
+
+type yumVersion struct {
+	Epoch string `xml:"epoch,attr"`
+	Ver   string `xml:"ver,attr"`
+	Rel   string `xml:"rel,attr"`
+}
+
+type yumChecksum struct {
+	Type  string `xml:"type,attr"`
+	PkgID string `xml:"pkgid,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type yumEntry struct {
+	Name  string `xml:"name,attr"`
+	Flags string `xml:"flags,attr,omitempty"`
+	Epoch string `xml:"epoch,attr,omitempty"`
+	Ver   string `xml:"ver,attr,omitempty"`
+	Rel   string `xml:"rel,attr,omitempty"`
+}
+
+type yumFile struct {
+	Type string `xml:"type,attr,omitempty"`
+	Path string `xml:",chardata"`
+}
+
+type yumPrimaryPackage struct {
+	Type        string      `xml:"type,attr"`
+	Name        string      `xml:"name"`
+	Arch        string      `xml:"arch"`
+	Version     yumVersion  `xml:"version"`
+	Checksum    yumChecksum `xml:"checksum"`
+	Summary     string      `xml:"summary"`
+	Description string      `xml:"description"`
+	Packager    string      `xml:"packager"`
+	URL         string      `xml:"url"`
+	Time        struct {
+		File  int64 `xml:"file,attr"`
+		Build int64 `xml:"build,attr"`
+	} `xml:"time"`
+	Size struct {
+		Package   int64 `xml:"package,attr"`
+		Installed int64 `xml:"installed,attr"`
+		Archive   int64 `xml:"archive,attr"`
+	} `xml:"size"`
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Format struct {
+		License     string `xml:"rpm:license"`
+		Vendor      string `xml:"rpm:vendor"`
+		Group       string `xml:"rpm:group"`
+		BuildHost   string `xml:"rpm:buildhost"`
+		SourceRPM   string `xml:"rpm:sourcerpm"`
+		HeaderRange struct {
+			Start int64 `xml:"start,attr"`
+			End   int64 `xml:"end,attr"`
+		} `xml:"rpm:header-range"`
+		Provides []yumEntry `xml:"rpm:provides>rpm:entry"`
+		Requires []yumEntry `xml:"rpm:requires>rpm:entry"`
+		Files    []yumFile  `xml:"file"`
+	} `xml:"format"`
+}
+
+type yumPrimary struct {
+	XMLName  xml.Name             `xml:"metadata"`
+	Xmlns    string               `xml:"xmlns,attr"`
+	XmlnsRPM string               `xml:"xmlns:rpm,attr"`
+	Count    int                  `xml:"packages,attr"`
+	Packages []*yumPrimaryPackage `xml:"package"`
+}
+
+type yumFilelistsPackage struct {
+	PkgID   string     `xml:"pkgid,attr"`
+	Name    string     `xml:"name,attr"`
+	Arch    string     `xml:"arch,attr"`
+	Version yumVersion `xml:"version"`
+	Files   []yumFile  `xml:"file"`
+}
+
+type yumFilelists struct {
+	XMLName  xml.Name               `xml:"filelists"`
+	Xmlns    string                 `xml:"xmlns,attr"`
+	Count    int                    `xml:"packages,attr"`
+	Packages []*yumFilelistsPackage `xml:"package"`
+}
+
+type yumOtherPackage struct {
+	PkgID   string     `xml:"pkgid,attr"`
+	Name    string     `xml:"name,attr"`
+	Arch    string     `xml:"arch,attr"`
+	Version yumVersion `xml:"version"`
+}
+
+type yumOther struct {
+	XMLName  xml.Name           `xml:"otherdata"`
+	Xmlns    string             `xml:"xmlns,attr"`
+	Count    int                `xml:"packages,attr"`
+	Packages []*yumOtherPackage `xml:"package"`
+}
+
+type yumRepomdData struct {
+	Type         string      `xml:"type,attr"`
+	Checksum     yumChecksum `xml:"checksum"`
+	OpenChecksum yumChecksum `xml:"open-checksum"`
+	Location     struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Timestamp int64 `xml:"timestamp"`
+	Size      int64 `xml:"size"`
+	OpenSize  int64 `xml:"open-size"`
+}
+
+type yumRepomd struct {
+	XMLName  xml.Name         `xml:"repomd"`
+	Xmlns    string           `xml:"xmlns,attr"`
+	XmlnsRPM string           `xml:"xmlns:rpm,attr"`
+	Revision int64            `xml:"revision"`
+	Data     []*yumRepomdData `xml:"data"`
+}
+
+// Files in primary metadata, others are only listed in filelists.
+var yumPrimaryFileReg = regexp.MustCompile(`^(/etc/|/usr/lib/sendmail$|.*bin/)`)
+
+func yumEntries(deps []*rpmDependency) []yumEntry {
+	entries := make([]yumEntry, 0, len(deps))
+	for _, dep := range deps {
+		entries = append(entries, yumEntry{
+			Name:  dep.Name,
+			Flags: dep.Flags,
+			Epoch: dep.Epoch,
+			Ver:   dep.Version,
+			Rel:   dep.Release,
+		})
+	}
+	return entries
+}
+
+func yumFiles(files []*rpmFile, filter *regexp.Regexp) []yumFile {
+	var items []yumFile
+	for _, file := range files {
+		if filter != nil && !filter.MatchString(file.Path) {
+			continue
+		}
+		item := yumFile{Path: file.Path}
+		if file.IsDir {
+			item.Type = "dir"
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// Refresh is the cache refresh hook regenerating the repository.
+func (y *Yum) Refresh(ctx context.Context, releases []*cache.Release) {
+	if err := y.Generate(ctx, releases); err != nil {
+		log.Error().Err(err).Msg("Generate YUM repository")
+	}
+}
+
+// Generate writes the repository of rpm assets in releases, and replaces the old one.
+func (y *Yum) Generate(ctx context.Context, releases []*cache.Release) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+
+	tmpDir := y.dir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+
+	primary := &yumPrimary{Xmlns: "http://linux.duke.edu/metadata/common", XmlnsRPM: "http://linux.duke.edu/metadata/rpm"}
+	filelists := &yumFilelists{Xmlns: "http://linux.duke.edu/metadata/filelists"}
+	other := &yumOther{Xmlns: "http://linux.duke.edu/metadata/other"}
+	for _, release := range releases {
+		for platform, asset := range release.Platforms {
+			if !strings.HasPrefix(platform, "rpm") {
+				continue
+			}
+			if err := y.cache.FillAsset(ctx, release, asset); err != nil {
+				log.Error().Err(err).Str("asset", asset.Name).Msg("Fill rpm")
+				continue
+			}
+
+			assetPath := y.cache.AssetFilePath(release, asset.Name)
+			pkg, err := readRPMPackage(assetPath)
+			if err != nil {
+				log.Error().Err(err).Str("asset", asset.Name).Msg("Read rpm header")
+				continue
+			}
+
+			href := path.Join("Packages", asset.Name)
+			if err := linkFile(assetPath, filepath.Join(tmpDir, href)); err != nil {
+				return err
+			}
+			hashes, err := hashFile(assetPath)
+			if err != nil {
+				return err
+			}
+			stat, err := os.Stat(assetPath)
+			if err != nil {
+				return err
+			}
+
+			version := yumVersion{Epoch: pkg.Epoch, Ver: pkg.Version, Rel: pkg.Release}
+			p := &yumPrimaryPackage{
+				Type:        "rpm",
+				Name:        pkg.Name,
+				Arch:        pkg.Arch,
+				Version:     version,
+				Checksum:    yumChecksum{Type: "sha256", PkgID: "YES", Value: hashes.SHA256},
+				Summary:     pkg.Summary,
+				Description: pkg.Description,
+				Packager:    pkg.Packager,
+				URL:         pkg.URL,
+			}
+			p.Time.File = stat.ModTime().Unix()
+			p.Time.Build = pkg.BuildTime
+			p.Size.Package = hashes.Size
+			p.Size.Installed = pkg.Size
+			p.Size.Archive = pkg.ArchiveSize
+			p.Location.Href = href
+			p.Format.License = pkg.License
+			p.Format.Vendor = pkg.Vendor
+			p.Format.Group = pkg.Group
+			p.Format.BuildHost = pkg.BuildHost
+			p.Format.SourceRPM = pkg.SourceRPM
+			p.Format.HeaderRange.Start = pkg.HeaderStart
+			p.Format.HeaderRange.End = pkg.HeaderEnd
+			p.Format.Provides = yumEntries(pkg.Provides)
+			p.Format.Requires = yumEntries(pkg.Requires)
+			p.Format.Files = yumFiles(pkg.Files, yumPrimaryFileReg)
+			primary.Packages = append(primary.Packages, p)
+
+			filelists.Packages = append(filelists.Packages, &yumFilelistsPackage{
+				PkgID:   hashes.SHA256,
+				Name:    pkg.Name,
+				Arch:    pkg.Arch,
+				Version: version,
+				Files:   yumFiles(pkg.Files, nil),
+			})
+			other.Packages = append(other.Packages, &yumOtherPackage{
+				PkgID:   hashes.SHA256,
+				Name:    pkg.Name,
+				Arch:    pkg.Arch,
+				Version: version,
+			})
+		}
+	}
+	primary.Count = len(primary.Packages)
+	filelists.Count = len(filelists.Packages)
+	other.Count = len(other.Packages)
+
+	now := time.Now().Unix()
+	repomd := &yumRepomd{
+		Xmlns:    "http://linux.duke.edu/metadata/repo",
+		XmlnsRPM: "http://linux.duke.edu/metadata/rpm",
+		Revision: now,
+	}
+	for _, item := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"primary", primary},
+		{"filelists", filelists},
+		{"other", other},
+	} {
+		data, err := y.writeMetadata(tmpDir, item.name, item.v, now)
+		if err != nil {
+			return err
+		}
+		repomd.Data = append(repomd.Data, data)
+	}
+
+	b, err := marshalXML(repomd)
+	if err != nil {
+		return err
+	}
+	repomdPath := filepath.Join(tmpDir, "repodata", "repomd.xml")
+	if err := ioutil.WriteFile(repomdPath, b, 0644); err != nil {
+		return err
+	}
+	if err := y.sign(tmpDir, repomdPath, b); err != nil {
+		return err
+	}
+	if err := y.writeRepoFile(tmpDir); err != nil {
+		return err
+	}
+
+	if err := replaceDir(tmpDir, y.dir); err != nil {
+		return err
+	}
+	log.Info().Str("dir", y.dir).Int("packages", primary.Count).Msg("Generated YUM repository")
+	return nil
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func (y *Yum) writeMetadata(repoDir string, name string, v interface{}, timestamp int64) (*yumRepomdData, error) {
+	b, err := marshalXML(v)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzipBytes(b)
+	if err != nil {
+		return nil, err
+	}
+
+	openHashes, err := hashReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := hashReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, err
+	}
+
+	href := path.Join("repodata", fmt.Sprintf("%s-%s.xml.gz", hashes.SHA256, name))
+	filename := filepath.Join(repoDir, filepath.FromSlash(href))
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filename, gz, 0644); err != nil {
+		return nil, err
+	}
+
+	data := &yumRepomdData{
+		Type:         name,
+		Checksum:     yumChecksum{Type: "sha256", Value: hashes.SHA256},
+		OpenChecksum: yumChecksum{Type: "sha256", Value: openHashes.SHA256},
+		Timestamp:    timestamp,
+		Size:         hashes.Size,
+		OpenSize:     openHashes.Size,
+	}
+	data.Location.Href = href
+	return data, nil
+}
+
+func (y *Yum) sign(repoDir string, repomdPath string, repomd []byte) error {
+	if y.signer == nil {
+		log.Warn().Msg("No signing key, YUM repository is unsigned")
+		return nil
+	}
+
+	signature, err := y.signer.DetachSign(repomd)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(repomdPath+".asc", signature, 0644); err != nil {
+		return err
+	}
+
+	publicKey, err := y.signer.PublicKey()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(repoDir, "key.asc"), publicKey, 0644)
+}
+
+// writeRepoFile writes the `.repo` file for installing into `/etc/yum.repos.d/`.
+func (y *Yum) writeRepoFile(repoDir string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[%s]\n", y.conf.Name)
+	fmt.Fprintf(&buf, "name=%s\n", y.conf.Name)
+	fmt.Fprintf(&buf, "baseurl=%s\n", y.baseURL)
+	fmt.Fprintf(&buf, "enabled=1\n")
+	fmt.Fprintf(&buf, "gpgcheck=0\n")
+	if y.signer != nil {
+		fmt.Fprintf(&buf, "repo_gpgcheck=1\n")
+		fmt.Fprintf(&buf, "gpgkey=%s/key.asc\n", y.baseURL)
+	}
+	return ioutil.WriteFile(filepath.Join(repoDir, y.conf.Name+".repo"), buf.Bytes(), 0644)
+}
@@ -0,0 +1,215 @@
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRPMTag struct {
+	tag   int32
+	typ   int32
+	value interface{}
+}
+
+// encodeRPMHeader encodes a header structure with tags.
+func encodeRPMHeader(tags []testRPMTag) []byte {
+	var index, store bytes.Buffer
+	for _, tag := range tags {
+		var count int32
+		offset := int32(store.Len())
+		switch v := tag.value.(type) {
+		case string:
+			store.WriteString(v)
+			store.WriteByte(0)
+			count = 1
+		case []string:
+			for _, s := range v {
+				store.WriteString(s)
+				store.WriteByte(0)
+			}
+			count = int32(len(v))
+		case []int32:
+			for store.Len()%4 != 0 {
+				store.WriteByte(0)
+			}
+			offset = int32(store.Len())
+			binary.Write(&store, binary.BigEndian, v)
+			count = int32(len(v))
+		}
+		binary.Write(&index, binary.BigEndian, rpmIndexEntry{Tag: tag.tag, Type: tag.typ, Offset: offset, Count: count})
+	}
+
+	var buf bytes.Buffer
+	buf.Write(rpmHeaderMagic)
+	buf.Write(make([]byte, 4))
+	binary.Write(&buf, binary.BigEndian, uint32(len(tags)))
+	binary.Write(&buf, binary.BigEndian, uint32(store.Len()))
+	buf.Write(index.Bytes())
+	buf.Write(store.Bytes())
+	return buf.Bytes()
+}
+
+// writeTestRPM writes a rpm package with lead, signature and header.
+func writeTestRPM(t *testing.T, filename string) {
+	var buf bytes.Buffer
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	buf.Write(lead)
+
+	signature := encodeRPMHeader([]testRPMTag{{tag: 1000, typ: rpmTypeInt32, value: []int32{1}}})
+	buf.Write(signature)
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+
+	buf.Write(encodeRPMHeader([]testRPMTag{
+		{rpmTagName, rpmTypeString, "crownote"},
+		{rpmTagVersion, rpmTypeString, "1.0.0"},
+		{rpmTagRelease, rpmTypeString, "1"},
+		{rpmTagSummary, rpmTypeI18NString, "Crownote"},
+		{rpmTagArch, rpmTypeString, "x86_64"},
+		{rpmTagBuildTime, rpmTypeInt32, []int32{1604326465}},
+		{rpmTagSize, rpmTypeInt32, []int32{1024}},
+		{rpmTagProvideName, rpmTypeStringArray, []string{"crownote", "crownote(x86-64)"}},
+		{rpmTagProvideFlags, rpmTypeInt32, []int32{rpmSenseEqual, rpmSenseEqual}},
+		{rpmTagProvideVersion, rpmTypeStringArray, []string{"1.0.0-1", "1.0.0-1"}},
+		{rpmTagRequireName, rpmTypeStringArray, []string{"libnotify", "rpmlib(CompressedFileNames)"}},
+		{rpmTagRequireFlags, rpmTypeInt32, []int32{0, rpmSenseLess | rpmSenseEqual}},
+		{rpmTagRequireVersion, rpmTypeStringArray, []string{"", "3.0.4-1"}},
+		{rpmTagFileModes, rpmTypeInt16, []int32{}},
+		{rpmTagDirIndexes, rpmTypeInt32, []int32{0, 1}},
+		{rpmTagBaseNames, rpmTypeStringArray, []string{"crownote", "crownote"}},
+		{rpmTagDirNames, rpmTypeStringArray, []string{"/usr/bin/", "/opt/Crownote/"}},
+	}))
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filename, buf.Bytes(), 0644))
+}
+
+func TestReadRPMPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-rpm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "crownote-1.0.0.x86_64.rpm")
+	writeTestRPM(t, filename)
+
+	pkg, err := readRPMPackage(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "crownote", pkg.Name)
+	assert.Equal(t, "0", pkg.Epoch)
+	assert.Equal(t, "1.0.0", pkg.Version)
+	assert.Equal(t, "1", pkg.Release)
+	assert.Equal(t, "x86_64", pkg.Arch)
+	assert.Equal(t, "Crownote", pkg.Summary)
+	assert.Equal(t, int64(1604326465), pkg.BuildTime)
+	assert.Equal(t, []*rpmDependency{
+		{Name: "crownote", Flags: "EQ", Epoch: "0", Version: "1.0.0", Release: "1"},
+		{Name: "crownote(x86-64)", Flags: "EQ", Epoch: "0", Version: "1.0.0", Release: "1"},
+	}, pkg.Provides)
+	assert.Equal(t, []*rpmDependency{{Name: "libnotify"}}, pkg.Requires)
+	assert.Equal(t, []*rpmFile{{Path: "/usr/bin/crownote"}, {Path: "/opt/Crownote/crownote"}}, pkg.Files)
+	assert.Equal(t, int64(rpmLeadSize+40), pkg.HeaderStart)
+}
+
+func TestReadRPMHeader_Invalid(t *testing.T) {
+	valid := encodeRPMHeader([]testRPMTag{{rpmTagName, rpmTypeString, "crownote"}})
+	_, err := readRPMHeader(bytes.NewReader(valid))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		offset int
+		value  uint32
+	}{
+		{"too many entries", 8, rpmMaxIndexEntries + 1},
+		{"too large store", 12, 1 << 31},
+		{"negative offset", 24, 0xffffffff},
+		{"negative count", 28, 0x80000000},
+		{"offset out of store", 24, 1 << 20},
+	}
+	for _, tt := range tests {
+		b := append([]byte{}, valid...)
+		binary.BigEndian.PutUint32(b[tt.offset:], tt.value)
+		_, err := readRPMHeader(bytes.NewReader(b))
+		assert.Error(t, err, tt.name)
+	}
+}
+
+func TestYum_Generate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohazel-yum")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &cache.GithubConfig{Owner: "panjiang", Repo: "gohazel-testing"}
+	release := &cache.Release{
+		Version: "v1.0.0",
+		Platforms: map[string]*cache.Asset{
+			"rpm": {Name: "crownote-1.0.0.x86_64.rpm"},
+		},
+	}
+	// The package of 0.9.0 fails to download.
+	failed := &cache.Release{Version: "v0.9.0", Platforms: map[string]*cache.Asset{"rpm": {Name: "crownote-0.9.0.x86_64.rpm"}}}
+	history := []*cache.Release{release, failed}
+	b, _ := json.Marshal(&cache.ReleaseData{Release: release, History: history, RepoURL: conf.RepoURL(), ProxyDownload: true})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "release.json"), b, 0644))
+	writeTestRPM(t, filepath.Join(dir, "panjiang", "gohazel-testing", "v1.0.0", "crownote-1.0.0.x86_64.rpm"))
+
+	c := cache.NewGithubCache(conf, &cache.Options{CacheDir: dir, ProxyDownload: true})
+	defer c.Stop()
+
+	keyFile := filepath.Join(dir, "key.asc")
+	writeTestKey(t, keyFile)
+	signer, err := NewSigner(&SigningConfig{KeyFile: keyFile})
+	require.NoError(t, err)
+
+	yumDir := filepath.Join(dir, "yum")
+	yum := NewYum(&YumConfig{Name: "crownote"}, c, signer, yumDir, "http://localhost:8400/yum")
+	require.NoError(t, yum.Generate(context.Background(), c.LoadReleases()))
+
+	assert.FileExists(t, filepath.Join(yumDir, "Packages", "crownote-1.0.0.x86_64.rpm"))
+	assert.FileExists(t, filepath.Join(yumDir, "repodata", "repomd.xml.asc"))
+	assert.FileExists(t, filepath.Join(yumDir, "key.asc"))
+
+	repomd, err := ioutil.ReadFile(filepath.Join(yumDir, "repodata", "repomd.xml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(repomd), `<data type="primary">`)
+
+	matches, _ := filepath.Glob(filepath.Join(yumDir, "repodata", "*-primary.xml.gz"))
+	require.Len(t, matches, 1)
+	f, err := os.Open(matches[0])
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	primary, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Contains(t, string(primary), `<location href="Packages/crownote-1.0.0.x86_64.rpm"></location>`)
+	assert.NotContains(t, string(primary), "crownote-0.9.0.x86_64.rpm")
+	assert.Contains(t, string(primary), `<rpm:entry name="crownote" flags="EQ" epoch="0" ver="1.0.0" rel="1"></rpm:entry>`)
+	assert.Contains(t, string(primary), `<file>/usr/bin/crownote</file>`)
+	assert.NotContains(t, string(primary), `<file>/opt/Crownote/crownote</file>`)
+
+	repoFile, err := ioutil.ReadFile(filepath.Join(yumDir, "crownote.repo"))
+	require.NoError(t, err)
+	assert.Contains(t, string(repoFile), "baseurl=http://localhost:8400/yum\n")
+	assert.Contains(t, string(repoFile), "gpgkey=http://localhost:8400/yum/key.asc\n")
+
+	// Regenerating replaces the old repository.
+	require.NoError(t, yum.Generate(context.Background(), c.LoadReleases()))
+	assert.FileExists(t, filepath.Join(yumDir, "repodata", "repomd.xml"))
+	for _, name := range []string{yumDir + ".tmp", yumDir + ".old"} {
+		_, err := os.Stat(name)
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/panjiang/gohazel/handler"
+	"github.com/rs/zerolog/log"
+)
+
+// exportVersion is the oldest version, which always gets the latest update.
+const exportVersion = "0.0.0"
+
+var redirectTemplate = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url={{ . }}">
+<link rel="canonical" href="{{ . }}">
+</head>
+<body><a href="{{ . }}">{{ . }}</a></body>
+</html>
+`))
+
+// Export writes static files of the routes for the cached releases into dir,
+// which can be uploaded to any static host serving at the base url:
+//
+//	update/:platform.json
+//	update/:platform/latest.yml
+//	update/win32/RELEASES
+//	download/:platform/index.html
+//	download/:platform/:version/index.html
+//	appcast/:channel.xml
+//	appinstaller
+//	assets/...
+func (s *Server) Export(dir string) error {
+	releases := s.cache.LoadReleases()
+	latest := s.cache.LoadCache()
+	if len(releases) == 0 || latest == nil {
+		return errors.New("no cached release")
+	}
+
+	e := &exporter{s: s, dir: dir}
+	e.write("/", "index.html")
+	e.write("/api/overview", "api/overview.json")
+	e.write("/appinstaller", "appinstaller")
+
+	channels := make(map[string]bool)
+	for _, release := range releases {
+		channel := release.Channel()
+		if channels[channel] {
+			continue
+		}
+		channels[channel] = true
+		e.write("/appcast/"+channel+".xml", "appcast/"+channel+".xml")
+	}
+
+	for platform := range latest.Platforms {
+		e.writeUpdate(platform)
+		e.write("/update/"+platform+"/"+exportVersion+"/latest.yml", "update/"+platform+"/latest.yml")
+		e.redirect("/download/"+platform, "download/"+platform+"/index.html")
+	}
+	e.write("/update/win32/"+exportVersion+"/RELEASES", "update/win32/RELEASES")
+
+	for _, release := range releases {
+		if s.cache.IsBlocked(release.Version) {
+			continue
+		}
+		for platform := range release.Platforms {
+			e.redirect("/download/"+platform+"/"+release.Version, "download/"+platform+"/"+release.Version+"/index.html")
+		}
+	}
+
+	if s.conf.ProxyDownload {
+		e.copyDir(filepath.Join(s.conf.CacheDir, s.conf.Github.Owner, s.conf.Github.Repo),
+			filepath.Join(s.conf.CacheURLPath(), s.conf.Github.Owner, s.conf.Github.Repo))
+	}
+	if s.conf.Landing.Enabled && s.conf.Landing.TemplateDir != "" {
+		e.copyDir(filepath.Join(s.conf.Landing.TemplateDir, handler.LandingStaticDir), "landing")
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+	log.Info().Str("dir", dir).Int("files", e.files).Msg("Exported")
+	return nil
+}
+
+// exporter renders routes with the server engine into files,
+// the first error is kept and stops following writes.
+type exporter struct {
+	s     *Server
+	dir   string
+	files int
+	err   error
+}
+
+func (e *exporter) get(uri string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, uri, nil))
+	return w
+}
+
+// location gets the redirect location of download routes.
+func (e *exporter) location(uri string) string {
+	w := e.get(uri)
+	if w.Code != http.StatusFound {
+		return ""
+	}
+	var data struct {
+		Location string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+		return ""
+	}
+	return data.Location
+}
+
+// write writes the response of uri to the file, responses without content are skipped.
+func (e *exporter) write(uri string, filename string) {
+	if e.err != nil {
+		return
+	}
+	w := e.get(uri)
+	if w.Code != http.StatusOK {
+		log.Debug().Str("uri", uri).Int("status", w.Code).Msg("Export skipped")
+		return
+	}
+	e.writeFile(filename, w.Body.Bytes())
+}
+
+// writeUpdate writes the update response, the url points to the asset directly
+// since query of the download url is lost on static hosts.
+func (e *exporter) writeUpdate(platform string) {
+	if e.err != nil {
+		return
+	}
+	w := e.get("/update/" + platform + "/" + exportVersion)
+	if w.Code != http.StatusOK {
+		return
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+		e.err = err
+		return
+	}
+	if location := e.location("/download/" + platform + "?update=true"); location != "" {
+		data["url"] = location
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		e.err = err
+		return
+	}
+	e.writeFile("update/"+platform+".json", b)
+}
+
+// redirect writes a meta refresh page to the download location.
+func (e *exporter) redirect(uri string, filename string) {
+	if e.err != nil {
+		return
+	}
+	location := e.location(uri)
+	if location == "" {
+		log.Debug().Str("uri", uri).Msg("Export skipped")
+		return
+	}
+	var b strings.Builder
+	if err := redirectTemplate.Execute(&b, location); err != nil {
+		e.err = err
+		return
+	}
+	e.writeFile(filename, []byte(b.String()))
+}
+
+func (e *exporter) writeFile(filename string, b []byte) {
+	filename = filepath.Join(e.dir, filepath.FromSlash(filename))
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		e.err = err
+		return
+	}
+	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		e.err = err
+		return
+	}
+	e.files++
+}
+
+// copyDir copies files in src into dir, hard links are preferred.
+func (e *exporter) copyDir(src string, dst string) {
+	if e.err != nil {
+		return
+	}
+	e.err = filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(e.dir, dst, rel)
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		os.Remove(target)
+		if err := os.Link(p, target); err != nil {
+			if err := copyFile(p, target); err != nil {
+				return fmt.Errorf("copy %s: %w", rel, err)
+			}
+		}
+		e.files++
+		return nil
+	})
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
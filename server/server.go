@@ -3,14 +3,19 @@ package server
 import (
 	"context"
 	"net/http"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/bundle"
 	"github.com/panjiang/gohazel/cache"
 	"github.com/panjiang/gohazel/config"
 	"github.com/panjiang/gohazel/handler"
+	"github.com/panjiang/gohazel/patch"
 	ginpkg "github.com/panjiang/gohazel/pkg/gin"
+	"github.com/panjiang/gohazel/pkg/logger"
+	"github.com/panjiang/gohazel/repo"
 	"github.com/rs/zerolog/log"
 )
 
@@ -18,6 +23,7 @@ import (
 type Server struct {
 	conf     *config.Config
 	cache    *cache.GithubCache
+	patcher  *patch.Patcher
 	engine   *gin.Engine
 	srv      *http.Server
 	shutdown bool
@@ -57,11 +63,18 @@ func (s *Server) Shutdown() {
 		s.cache.Stop()
 		s.cache = nil
 	}
+
+	if s.patcher != nil {
+		s.patcher.Stop()
+		s.patcher = nil
+	}
 	s.mu.Unlock()
 }
 
 // NewServer will setup a new server with specific config.
 func NewServer(conf *config.Config) *Server {
+	logger.AddSecret(conf.Github.Token, conf.Github.WebhookSecret, conf.Admin.Token, conf.Signing.Passphrase)
+
 	// Router
 	r := ginpkg.New(conf.Debug)
 	r.Use()
@@ -80,19 +93,124 @@ func NewServer(conf *config.Config) *Server {
 	logev.Msg("Proxy download")
 
 	// Cache
-	cache := cache.NewGithubCache(&conf.Github, conf.CacheDir, conf.ProxyDownload, conf.CacheURLBase())
+	cache := cache.NewGithubCache(&conf.Github, conf.CacheOptions())
+
+	// Linux repositories
+	signer, err := repo.NewSigner(&conf.Signing)
+	if err != nil {
+		log.Error().Err(err).Msg("Read signing key")
+	}
+	if conf.Apt.Enabled {
+		apt := repo.NewApt(&conf.Apt, cache, signer, conf.AptDir())
+		cache.AddRefreshHook(apt.Refresh)
+		r.Static("apt", conf.AptDir())
+		log.Info().Str("dir", conf.AptDir()).Msg("APT repository")
+	}
+	if conf.Yum.Enabled {
+		if conf.Yum.Name == "" {
+			conf.Yum.Name = conf.Github.Repo
+		}
+		yum := repo.NewYum(&conf.Yum, cache, signer, conf.YumDir(), conf.YumURL())
+		cache.AddRefreshHook(yum.Refresh)
+		r.Static("yum", conf.YumDir())
+		log.Info().Str("dir", conf.YumDir()).Str("url", conf.YumURL()).Msg("YUM repository")
+	}
+
+	// NuGet feed
+	var nuget *repo.Nuget
+	if conf.Nuget.Enabled {
+		nuget = repo.NewNuget(cache)
+		cache.AddRefreshHook(nuget.Refresh)
+		log.Info().Msg("NuGet feed")
+	}
+
+	// Patches
+	var patcher *patch.Patcher
+	if conf.Patch.Enabled {
+		patcher = patch.NewPatcher(&conf.Patch, cache)
+		cache.AddRefreshHook(patcher.Refresh)
+		log.Info().Strs("platforms", conf.Patch.Platforms).Int("depth", conf.Patch.Depth).Int64("maxSize", conf.Patch.MaxSize).Msg("Patch")
+	}
+
+	// Bundles
+	var bundler *bundle.Bundler
+	if conf.Bundle.PrivateKey != "" || conf.Bundle.PublicKey != "" {
+		bundler, err = bundle.NewBundler(&conf.Bundle, cache, conf.Github.RepoURL(), conf.CacheURLBase())
+		if err != nil {
+			log.Error().Err(err).Msg("Read bundle key")
+		}
+	}
 
 	// Handler
-	h := handler.NewHandler(conf, cache)
+	h := handler.NewHandler(conf, cache, patcher, nuget, bundler)
+	r.GET("/health", h.Health)
+	r.GET("/metrics", h.Metrics)
+	appRoutes(r, conf, h)
+
+	// Other apps in the same repo, sharing the github client.
+	for i := range conf.Apps {
+		app := &conf.Apps[i]
+		appConf := conf.App(app)
+		appCache := cache.NewApp(app.Name, &app.ReleaseFilter, appConf.CacheOptions())
+		g := r.Group("/" + conf.AppPath(app))
+		if appConf.ProxyDownload {
+			g.Static(appConf.CacheURLPath(), appConf.CacheDir)
+		}
+		appRoutes(g, appConf, handler.NewHandler(appConf, appCache, nil, nil, nil))
+	}
+
+	if conf.Github.WebhookSecret != "" {
+		r.POST("/webhook/github", h.GithubWebhook)
+	}
+
+	// Admin API
+	if conf.Admin.Token != "" {
+		admin := r.Group("/admin", ginpkg.TokenAuth(conf.Admin.Token))
+		admin.GET("/config", h.Config)
+		admin.POST("/bundle", h.ImportBundle)
+		admin.POST("/refresh", h.Refresh)
+		admin.GET("/update", h.UpdatePolicy)
+		log.Info().Msg("Admin API")
+	}
+
+	// Compatible routes
+	if conf.Compat.Nuts {
+		r.GET("/api/versions", h.Versions)
+		r.GET("/notes/:version", h.Notes)
+	}
+	if conf.Compat.Electron || conf.Compat.Nuts {
+		r.NoRoute(h.Compat)
+		log.Info().Bool("electron", conf.Compat.Electron).Bool("nuts", conf.Compat.Nuts).Msg("Compatible routes")
+	}
+	return &Server{
+		conf:    conf,
+		cache:   cache,
+		patcher: patcher,
+		engine:  r,
+	}
+}
+
+// appRoutes registers routes of downloading and updating the app.
+func appRoutes(r gin.IRoutes, conf *config.Config, h *handler.Handler) {
 	r.GET("/", h.Overview)
+	r.GET("/api/overview", h.OverviewJSON)
+	if conf.Landing.Enabled && conf.Landing.TemplateDir != "" {
+		r.Static("landing", filepath.Join(conf.Landing.TemplateDir, handler.LandingStaticDir))
+	}
 	r.GET("/download", h.Download)
 	r.GET("/download/:platform", h.DownloadPlatform)
+	r.GET("/download/:platform/:version", h.DownloadVersion) // Or `/download/:version/:filename`
 	r.GET("/update/:platform/:version", h.Update)
 	r.GET("/update/:platform/:version/RELEASES", h.Releases) // `/update/win32/:version/RELEASES`
 	r.GET("/update/:platform/:version/latest.yml", h.UpdateLatestYml)
-	return &Server{
-		conf:   conf,
-		cache:  cache,
-		engine: r,
+	r.GET("/appinstaller", h.AppInstaller)
+	r.GET("/appcast/:channel", h.Appcast) // `/appcast/stable.xml`
+	r.GET("/tauri/:target/:arch/:current_version", h.Tauri)
+	r.GET("/patch/:platform/:from/:to", h.Patch)
+	if conf.Manifests.Enabled {
+		r.GET("/manifests/:file", h.Manifest) // `/manifests/winget.yaml`
+	}
+	if conf.Nuget.Enabled {
+		r.GET("/nuget/*path", h.Nuget)
 	}
 }
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAdminBundle(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-admin"
+	conf.Github.Repo = "gohazel-testing"
+	conf.Admin.Token = "secret"
+	conf.Github.Token = "github-token"
+	conf.ProxyDownload = true
+	os.MkdirAll(conf.CacheDir, os.ModePerm)
+	defer os.RemoveAll(conf.CacheDir)
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	post := func(token string) int {
+		req, err := http.NewRequest(http.MethodPost, conf.BaseURL+"/admin/bundle", strings.NewReader("bundle"))
+		if err != nil {
+			panic(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Wait for the server.
+	Request(conf.BaseURL, "/ping")
+
+	tests := []struct {
+		token string
+		code  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		// No bundle key is configured.
+		{"secret", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := post(tt.token); code != tt.code {
+			t.Errorf("token %q: expected code is %v, got %v", tt.token, tt.code, code)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, conf.BaseURL+"/admin/config", nil)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(b), "owner: atom") {
+		t.Fatalf("unexpected config: %d %s", resp.StatusCode, b)
+	}
+	if strings.Contains(string(b), "github-token") || strings.Contains(string(b), "secret") {
+		t.Errorf("secrets are not redacted: %s", b)
+	}
+}
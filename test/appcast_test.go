@@ -0,0 +1,104 @@
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/panjiang/gohazel/cache"
+)
+
+func TestAppcast(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-appcast"
+	conf.Github.Repo = "gohazel-testing"
+	conf.KeepReleases = 5
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(version string, signature string) *cache.Release {
+		return &cache.Release{
+			Version: version,
+			HTMLURL: "https://github.com/atom/gohazel-testing/releases/tag/" + version,
+			Meta:    &cache.ReleaseMeta{MinimumSystemVersion: "10.13"},
+			Platforms: map[string]*cache.Asset{
+				"darwin": {
+					Name:               "App-mac.zip",
+					BrowserDownloadURL: "https://github.com/atom/gohazel-testing/releases/download/" + version + "/App-mac.zip",
+					Length:             1024,
+					Signature:          signature,
+				},
+			},
+		}
+	}
+	latest := newRelease("v1.1.0-beta.1", "c2lnbmF0dXJlMg==")
+	// Tagged with the app prefix, and the link to it is made.
+	latest.Tag = "desktop-v1.1.0-beta.1"
+	latest.HTMLURL = ""
+	WriteReleaseData(conf, &cache.ReleaseData{
+		Release: latest,
+		History: []*cache.Release{latest, newRelease("v1.0.0", "c2lnbmF0dXJlMQ==")},
+	})
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	code, data := Request(conf.BaseURL, "/appcast/stable.xml")
+	if code != 200 {
+		t.Fatalf("expected code is 200, got %v", code)
+	}
+	feed := string(data)
+	for _, s := range []string{
+		`<sparkle:version>1.0.0</sparkle:version>`,
+		`<sparkle:minimumSystemVersion>10.13</sparkle:minimumSystemVersion>`,
+		`<sparkle:releaseNotesLink>https://github.com/atom/gohazel-testing/releases/tag/v1.0.0</sparkle:releaseNotesLink>`,
+		`<enclosure url="https://github.com/atom/gohazel-testing/releases/download/v1.0.0/App-mac.zip" length="1024" type="application/octet-stream" sparkle:edSignature="c2lnbmF0dXJlMQ=="></enclosure>`,
+	} {
+		if !strings.Contains(feed, s) {
+			t.Errorf("stable feed doesn't contain %s", s)
+		}
+	}
+	if strings.Contains(feed, "1.1.0-beta.1") {
+		t.Errorf("stable feed contains beta release")
+	}
+
+	_, data = Request(conf.BaseURL, "/appcast/beta.xml")
+	if !strings.Contains(string(data), `<sparkle:channel>beta</sparkle:channel>`) {
+		t.Errorf("beta feed doesn't contain beta release")
+	}
+	if link := `<sparkle:releaseNotesLink>https://github.com/atom/gohazel-testing/releases/tag/desktop-v1.1.0-beta.1</sparkle:releaseNotesLink>`; !strings.Contains(string(data), link) {
+		t.Errorf("beta feed doesn't contain %s", link)
+	}
+}
+
+func TestAppcastProxy(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-appcast-proxy"
+	conf.Github.Repo = "gohazel-testing"
+	conf.ProxyDownload = true
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(version string) *cache.Release {
+		return NewRelease(conf, version, map[string]string{"darwin": "App-mac.zip"})
+	}
+	latest := newRelease("v1.1.0")
+	// Only assets of the latest release are cached ahead.
+	WriteReleases(conf, latest, latest)
+	WriteReleaseData(conf, &cache.ReleaseData{
+		Release: latest,
+		History: []*cache.Release{newRelease("v1.2.0-beta.1"), latest, newRelease("v1.0.0")},
+	})
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	_, data := Request(conf.BaseURL, "/appcast/beta.xml")
+	for _, version := range []string{"v1.2.0-beta.1", "v1.1.0", "v1.0.0"} {
+		enclosure := `<enclosure url="` + conf.BaseURL + `/assets/atom/gohazel-testing/` + version + `/App-mac.zip"`
+		if !strings.Contains(string(data), enclosure) {
+			t.Errorf("beta feed doesn't contain %s", enclosure)
+		}
+		if code, _ := Request(conf.BaseURL, "/assets/atom/gohazel-testing/"+version+"/App-mac.zip"); code != 200 {
+			t.Errorf("%s: expected code of enclosure is 200, got %v", version, code)
+		}
+	}
+}
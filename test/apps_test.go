@@ -0,0 +1,69 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+	"github.com/panjiang/gohazel/config"
+)
+
+func TestApps(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-apps"
+	conf.Github.Repo = "monorepo"
+	conf.Github.TagPrefix = "desktop-"
+	conf.Apps = []config.AppConfig{{Name: "cli", ReleaseFilter: cache.ReleaseFilter{TagPrefix: "cli-"}}}
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(tag string, version string) *cache.Release {
+		return &cache.Release{
+			Version: version,
+			Tag:     tag,
+			Platforms: map[string]*cache.Asset{
+				"exe": {
+					Name:               "App-Setup.exe",
+					BrowserDownloadURL: "https://github.com/atom/monorepo/releases/download/" + tag + "/App-Setup.exe",
+				},
+			},
+		}
+	}
+	desktop := newRelease("desktop-v2.3.0", "v2.3.0")
+	WriteReleaseData(conf, &cache.ReleaseData{Release: desktop, History: []*cache.Release{desktop}})
+	cli := newRelease("cli-v1.1.0", "v1.1.0")
+	WriteReleaseData(conf.App(&conf.Apps[0]), &cache.ReleaseData{Release: cli, History: []*cache.Release{cli}})
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	tests := []struct {
+		uri      string
+		code     int
+		location string
+	}{
+		{"/download/exe", 302, "https://github.com/atom/monorepo/releases/download/desktop-v2.3.0/App-Setup.exe"},
+		{"/apps/cli/download/exe", 302, "https://github.com/atom/monorepo/releases/download/cli-v1.1.0/App-Setup.exe"},
+		{"/apps/cli/download/exe/1.1.0", 302, "https://github.com/atom/monorepo/releases/download/cli-v1.1.0/App-Setup.exe"},
+		{"/apps/cli/download/exe/2.3.0", 404, ""},
+		{"/apps/unknown/download/exe", 404, ""},
+	}
+	for _, tt := range tests {
+		code, data := Request(conf.BaseURL, tt.uri)
+		if code != tt.code {
+			t.Errorf("%s: expected code is %v, got %v", tt.uri, tt.code, code)
+			continue
+		}
+		if tt.location == "" {
+			continue
+		}
+		var body gin.H
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["Location"] != tt.location {
+			t.Errorf("%s: expected location is %v, got %v", tt.uri, tt.location, body["Location"])
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompatRoutes(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-compat"
+	conf.Github.Repo = "gohazel-testing"
+	conf.Compat.Electron = true
+	conf.Compat.Nuts = true
+	defer os.RemoveAll(conf.CacheDir)
+
+	latest := NewRelease(conf, "v1.1.0", map[string]string{"darwin": "App-mac.zip", "dmg": "App.dmg"})
+	latest.Notes = "Fixes"
+	latest.RELEASES = "SHA1 App-1.1.0-full.nupkg 1024"
+	WriteReleases(conf, latest, latest)
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	tests := []struct {
+		uri  string
+		code int
+		key  string
+		val  string
+	}{
+		{"/atom/gohazel-testing/darwin-x64/1.0.0", 200, "url", "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/App-mac.zip"},
+		{"/atom/gohazel-testing/darwin-arm64/1.1.0", 204, "", ""},
+		{"/atom/gohazel-testing/win32-x64/1.0.0/RELEASES", 200, "", ""},
+		{"/atom/gohazel-testing/linux-x64/1.0.0", 400, "", ""},
+		{"/atom/other/darwin-x64/1.0.0", 404, "", ""},
+		{"/download/channel/beta/osx_64", 302, "Location", "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/App.dmg"},
+		{"/update/osx_64/1.0.0", 200, "url", "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/App-mac.zip"},
+		{"/notes/1.1.0", 200, "", ""},
+		{"/notes/2.0.0", 404, "", ""},
+	}
+	for _, tt := range tests {
+		code, data := Request(conf.BaseURL, tt.uri)
+		if code != tt.code {
+			t.Errorf("%s: expected code is %v, got %v", tt.uri, tt.code, code)
+			continue
+		}
+		if tt.key == "" {
+			continue
+		}
+		var h gin.H
+		if err := json.Unmarshal(data, &h); err != nil {
+			panic(err)
+		}
+		if h[tt.key] != tt.val {
+			t.Errorf("%s: expected %s is %v, got %v", tt.uri, tt.key, tt.val, h[tt.key])
+		}
+	}
+
+	code, data := Request(conf.BaseURL, "/api/versions")
+	var versions []struct {
+		Tag       string  `json:"tag"`
+		Channel   string  `json:"channel"`
+		Platforms []gin.H `json:"platforms"`
+	}
+	if err := json.Unmarshal(data, &versions); err != nil {
+		panic(err)
+	}
+	if code != 200 || len(versions) != 1 || versions[0].Tag != "v1.1.0" || versions[0].Channel != "stable" || len(versions[0].Platforms) != 2 {
+		t.Errorf("Unexpected versions: %v %s", code, data)
+	}
+}
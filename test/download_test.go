@@ -0,0 +1,72 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+)
+
+func TestDownloadVersion(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-download"
+	conf.Github.Repo = "gohazel-testing"
+	conf.KeepReleases = 5
+	conf.BlockedVersions = []string{"v0.9.0"}
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(version string) *cache.Release {
+		return &cache.Release{
+			Version: version,
+			Platforms: map[string]*cache.Asset{
+				"exe": {
+					Name:               "App-Setup-" + version + ".exe",
+					BrowserDownloadURL: "https://github.com/atom/gohazel-testing/releases/download/" + version + "/App-Setup.exe",
+				},
+			},
+		}
+	}
+	latest := newRelease("v1.1.0")
+	WriteReleaseData(conf, &cache.ReleaseData{
+		Release: latest,
+		History: []*cache.Release{latest, newRelease("v1.0.0"), newRelease("v0.9.0")},
+	})
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	tests := []struct {
+		uri      string
+		code     int
+		location string
+	}{
+		{"/download/win/1.0.0", 302, "https://github.com/atom/gohazel-testing/releases/download/v1.0.0/App-Setup.exe"},
+		{"/download/v1.0.0/App-Setup-v1.0.0.exe", 302, "https://github.com/atom/gohazel-testing/releases/download/v1.0.0/App-Setup.exe"},
+		{"/download/exe/v1.1.0", 302, "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/App-Setup.exe"},
+		{"/download/v1.0.0/unknown.exe", 404, ""},
+		{"/download/exe/2.0.0", 404, ""},
+		{"/download/exe/0.9.0", 410, ""},
+		{"/download/unknown/1.0.0", 400, ""},
+		{"/download?format=windows", 302, "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/App-Setup.exe"},
+		{"/download?format=unknown", 400, ""},
+	}
+	for _, tt := range tests {
+		code, data := Request(conf.BaseURL, tt.uri)
+		if code != tt.code {
+			t.Errorf("%s: expected code is %v, got %v", tt.uri, tt.code, code)
+			continue
+		}
+		if tt.location == "" {
+			continue
+		}
+		var h gin.H
+		if err := json.Unmarshal(data, &h); err != nil {
+			panic(err)
+		}
+		if h["Location"] != tt.location {
+			t.Errorf("%s: expected location is %v, got %v", tt.uri, tt.location, h["Location"])
+		}
+	}
+}
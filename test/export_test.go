@@ -0,0 +1,82 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/panjiang/gohazel/cache"
+	"github.com/panjiang/gohazel/server"
+)
+
+func TestExport(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-export"
+	conf.Github.Repo = "gohazel-testing"
+	conf.ProxyDownload = true
+	conf.Offline = true
+	out := "/tmp/assets-export-out"
+	defer os.RemoveAll(conf.CacheDir)
+	defer os.RemoveAll(out)
+
+	newRelease := func(version string) *cache.Release {
+		release := NewRelease(conf, version, map[string]string{"exe": "App-Setup-" + version + ".exe", "dmg": "App-" + version + ".dmg"})
+		release.Notes = "Notes of " + version
+		release.Platforms["exe"].Yml = &cache.LatestYml{Content: "version: " + version}
+		return release
+	}
+	latest := newRelease("v1.1.0")
+	latest.RELEASES = "SHA1 App-1.1.0-full.nupkg 100"
+	// The beta is not the latest served, and has no dmg.
+	beta := newRelease("v1.2.0-beta.1")
+	delete(beta.Platforms, "dmg")
+	WriteReleases(conf, latest, beta, latest, newRelease("v1.0.0"))
+
+	os.Setenv("MODE", "TESTING")
+	s := server.NewServer(conf)
+	defer s.Shutdown()
+	if err := s.Export(out); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Errorf("read %s: %v", name, err)
+		}
+		return string(b)
+	}
+
+	var update map[string]interface{}
+	if err := json.Unmarshal([]byte(read("update/exe.json")), &update); err != nil {
+		t.Fatal(err)
+	}
+	assetURL := "http://localhost:18080/assets/atom/gohazel-testing/v1.1.0/App-Setup-v1.1.0.exe"
+	if update["name"] != "v1.1.0" || update["url"] != assetURL {
+		t.Errorf("unexpected update: %v", update)
+	}
+	if yml := read("update/exe/latest.yml"); yml != "version: v1.1.0" {
+		t.Errorf("unexpected latest.yml: %s", yml)
+	}
+	if releases := read("update/win32/RELEASES"); !strings.Contains(releases, "App-1.1.0-full.nupkg") {
+		t.Errorf("unexpected RELEASES: %s", releases)
+	}
+	if page := read("download/exe/index.html"); !strings.Contains(page, `content="0; url=`+assetURL+`"`) {
+		t.Errorf("unexpected download page: %s", page)
+	}
+	if page := read("download/dmg/index.html"); !strings.Contains(page, "v1.1.0/App-v1.1.0.dmg") {
+		t.Errorf("unexpected latest download page: %s", page)
+	}
+	if page := read("download/dmg/v1.0.0/index.html"); !strings.Contains(page, "v1.0.0/App-v1.0.0.dmg") {
+		t.Errorf("unexpected download page: %s", page)
+	}
+	if asset := read("assets/atom/gohazel-testing/v1.0.0/App-Setup-v1.0.0.exe"); asset != "App-Setup-v1.0.0.exe" {
+		t.Errorf("unexpected asset: %s", asset)
+	}
+	if _, err := os.Stat(filepath.Join(out, "update/dmg/latest.yml")); !os.IsNotExist(err) {
+		t.Errorf("expected no latest.yml of dmg, got %v", err)
+	}
+}
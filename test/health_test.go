@@ -0,0 +1,50 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/panjiang/gohazel/cache"
+)
+
+func TestHealth(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-health"
+	conf.Github.Repo = "gohazel-testing"
+	defer os.RemoveAll(conf.CacheDir)
+
+	latest := &cache.Release{Version: "v1.1.0", Platforms: map[string]*cache.Asset{}}
+	WriteReleaseData(conf, &cache.ReleaseData{Release: latest, History: []*cache.Release{latest}})
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	code, data := Request(conf.BaseURL, "/health")
+	if code != 200 {
+		t.Fatalf("expected code is 200, got %d", code)
+	}
+	var health struct {
+		Status    string
+		Version   string
+		Releases  int
+		RateLimit cache.RateLimit
+	}
+	if err := json.Unmarshal(data, &health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "ok" || health.Version != "v1.1.0" || health.Releases != 1 {
+		t.Errorf("unexpected health: %s", data)
+	}
+
+	code, data = Request(conf.BaseURL, "/metrics")
+	if code != 200 {
+		t.Fatalf("expected code is 200, got %d", code)
+	}
+	for _, line := range []string{"gohazel_releases 1\n", "# TYPE gohazel_github_requests_total counter\n", "gohazel_github_rate_limit_remaining "} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("expected %q in metrics: %s", line, data)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestManifests(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-manifests"
+	conf.Github.Repo = "gohazel-testing"
+	conf.ProxyDownload = true
+	conf.Manifests.Enabled = true
+	conf.Manifests.Name = "Atom"
+	conf.Manifests.Description = "A hackable text editor"
+	defer os.RemoveAll(conf.CacheDir)
+
+	release := NewRelease(conf, "v1.1.0", map[string]string{"exe": "AtomSetup.exe", "msi": "AtomSetup.msi", "dmg": "Atom.dmg"})
+	WriteReleases(conf, release, release)
+	sums := map[string]string{}
+	for platform, asset := range release.Platforms {
+		sum := sha256.Sum256([]byte(asset.Name))
+		sums[platform] = hex.EncodeToString(sum[:])
+	}
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	tests := []struct {
+		uri      string
+		code     int
+		contains []string
+	}{
+		{"/manifests/winget.yaml", 200, []string{
+			"PackageIdentifier: atom.Atom\n",
+			"PackageVersion: 1.1.0\n",
+			"InstallerUrl: http://localhost:18080/assets/atom/gohazel-testing/v1.1.0/AtomSetup.msi\n",
+			"InstallerSha256: " + sums["msi"] + "\n",
+		}},
+		{"/manifests/homebrew.rb", 200, []string{
+			`cask "gohazel-testing" do`,
+			`sha256 "` + sums["dmg"] + `"`,
+			`app "Atom.app"`,
+		}},
+		{"/manifests/chocolatey.nuspec", 200, []string{"<version>1.1.0</version>"}},
+		{"/manifests/chocolateyinstall.ps1", 200, []string{"fileType       = 'msi'", "checksum64     = '" + sums["msi"] + "'"}},
+		{"/manifests/scoop.json", 404, nil},
+	}
+	for _, tt := range tests {
+		code, data := Request(conf.BaseURL, tt.uri)
+		if code != tt.code {
+			t.Errorf("%s: expected code is %v, got %v", tt.uri, tt.code, code)
+			continue
+		}
+		for _, s := range tt.contains {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("%s: expected to contain %q, got:\n%s", tt.uri, s, data)
+			}
+		}
+	}
+}
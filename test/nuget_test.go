@@ -0,0 +1,67 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/panjiang/gohazel/cache"
+)
+
+func TestNuget(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-nuget"
+	conf.Github.Repo = "gohazel-testing"
+	conf.ProxyDownload = true
+	conf.Nuget.Enabled = true
+	defer os.RemoveAll(conf.CacheDir)
+
+	var history []*cache.Release
+	for _, version := range []string{"1.2.0-beta.1", "1.1.0"} {
+		name := "atom-" + version + "-full.nupkg"
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, _ := zw.Create("atom.nuspec")
+		w.Write([]byte(`<package><metadata><id>atom</id><version>` + version + `</version><authors>GitHub</authors></metadata></package>`))
+		zw.Close()
+		WriteAsset(conf, "v"+version, name, buf.Bytes())
+		history = append(history, &cache.Release{Version: "v" + version, Nupkgs: []*cache.Asset{{Name: name}}})
+	}
+	WriteReleases(conf, history[1], history...)
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+	<-time.After(200 * time.Millisecond)
+
+	tests := []struct {
+		uri      string
+		code     int
+		contains string
+	}{
+		{"/nuget/", 200, `<collection href="Packages">`},
+		{"/nuget/$metadata", 200, `<EntitySet Name="Packages"`},
+		{"/nuget/Packages()", 200, `<d:Version>1.1.0</d:Version>`},
+		{"/nuget/FindPackagesById()?id='atom'", 200, `<content type="application/zip" src="http://localhost:18080/nuget/package/atom/1.1.0" />`},
+		{"/nuget/FindPackagesById()?id='other'", 200, `<title type="text">FindPackagesById</title>`},
+		{"/nuget/Packages(Id='atom',Version='1.1.0')", 200, `<d:IsLatestVersion m:type="Edm.Boolean">true</d:IsLatestVersion>`},
+		{"/nuget/Packages(Id='atom',Version='1.2.0-beta.1')", 200, `<d:IsAbsoluteLatestVersion m:type="Edm.Boolean">true</d:IsAbsoluteLatestVersion>`},
+		{"/nuget/Packages(Id='atom',Version='1.2.0-beta.1')", 200, `<d:IsLatestVersion m:type="Edm.Boolean">false</d:IsLatestVersion>`},
+		{"/nuget/Packages()?$filter=IsLatestVersion", 200, `<d:Version>1.1.0</d:Version>`},
+		{"/nuget/Packages()?$filter=IsAbsoluteLatestVersion", 200, `<d:Version>1.2.0-beta.1</d:Version>`},
+		{"/nuget/Packages(Id='atom',Version='1.0.0')", 404, ""},
+		{"/nuget/package/atom/1.1.0", 200, "atom.nuspec"},
+	}
+	for _, tt := range tests {
+		code, data := Request(conf.BaseURL, tt.uri)
+		if code != tt.code {
+			t.Errorf("%s: expected code is %v, got %v", tt.uri, tt.code, code)
+			continue
+		}
+		if !strings.Contains(string(data), tt.contains) {
+			t.Errorf("%s: expected to contain %q, got:\n%s", tt.uri, tt.contains, data)
+		}
+	}
+}
@@ -2,9 +2,15 @@ package test
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
 )
 
 func TestOverview(t *testing.T) {
@@ -24,3 +30,97 @@ func TestOverview(t *testing.T) {
 		t.Errorf("Expected owner is atom, got %v", h["owner"])
 	}
 }
+
+func TestOverviewAPI(t *testing.T) {
+	conf := DefaultConfig()
+	conf.Landing.Enabled = true
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	code, data := Request(conf.BaseURL, "/api/overview")
+	if code != 200 {
+		t.Errorf("Expected code is 200, got %v", code)
+	}
+	var h gin.H
+	if err := json.Unmarshal(data, &h); err != nil {
+		panic(err)
+	}
+	if h["repo"] != "atom" {
+		t.Errorf("Expected repo is atom, got %v", h["repo"])
+	}
+}
+
+func TestLanding(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-landing"
+	conf.Landing.Enabled = true
+	conf.Landing.Title = "Atom Editor"
+	conf.Landing.TemplateDir = "/tmp/assets-landing-templates"
+	defer os.RemoveAll(conf.CacheDir)
+	defer os.RemoveAll(conf.Landing.TemplateDir)
+
+	staticDir := filepath.Join(conf.Landing.TemplateDir, "static")
+	if err := os.MkdirAll(staticDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(staticDir, "logo.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The default template is used, and the override file is not served.
+	if err := ioutil.WriteFile(filepath.Join(conf.Landing.TemplateDir, "secret.html"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	release := &cache.Release{
+		Version: "v1.1.0",
+		Notes:   "**Fixed** crashes",
+		Platforms: map[string]*cache.Asset{
+			"dmg": {Name: "Atom-1.1.0.dmg", BrowserDownloadURL: "https://github.com/atom/atom/releases/download/v1.1.0/Atom-1.1.0.dmg"},
+			"exe": {Name: "AtomSetup-1.1.0.exe", BrowserDownloadURL: "https://github.com/atom/atom/releases/download/v1.1.0/AtomSetup-1.1.0.exe"},
+		},
+	}
+	WriteReleaseData(conf, &cache.ReleaseData{Release: release})
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	mac := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.198 Safari/537.36"
+	windows := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.198 Safari/537.36"
+	tests := []struct {
+		accept    string
+		userAgent string
+		contains  []string
+	}{
+		{"text/html,application/xhtml+xml", mac, []string{
+			"<title>Atom Editor</title>",
+			"<strong>Fixed</strong> crashes",
+			`<a class="button" href="https://github.com/atom/atom/releases/download/v1.1.0/Atom-1.1.0.dmg">Download for macOS</a>`,
+			"<tr class=\"recommended\">\n<td>macOS</td>",
+		}},
+		{"text/html", windows, []string{
+			`<a class="button" href="https://github.com/atom/atom/releases/download/v1.1.0/AtomSetup-1.1.0.exe">Download for Windows</a>`,
+			"<tr class=\"recommended\">\n<td>Windows</td>",
+		}},
+		{"application/json", mac, []string{`"owner":"atom"`}},
+		{"", mac, []string{`"owner":"atom"`}},
+	}
+	for _, tt := range tests {
+		code, data := RequestWithHeader(conf.BaseURL, "/", http.Header{"Accept": {tt.accept}, "User-Agent": {tt.userAgent}})
+		if code != 200 {
+			t.Errorf("%s: expected code is 200, got %v", tt.accept, code)
+			continue
+		}
+		for _, s := range tt.contains {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("%s: expected to contain %q, got:\n%s", tt.accept, s, data)
+			}
+		}
+	}
+
+	if code, data := Request(conf.BaseURL, "/landing/logo.png"); code != 200 || string(data) != "png" {
+		t.Errorf("expected static file is served, got %v %s", code, data)
+	}
+	if code, _ := Request(conf.BaseURL, "/landing/secret.html"); code != 404 {
+		t.Errorf("expected template dir is not served, got %v", code)
+	}
+}
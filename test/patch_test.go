@@ -0,0 +1,57 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+)
+
+func TestPatch(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-patch"
+	conf.Github.Repo = "gohazel-testing"
+	conf.ProxyDownload = true
+	conf.KeepReleases = 5
+	conf.Patch.Enabled = true
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(version string) *cache.Release {
+		return NewRelease(conf, version, map[string]string{"exe": "App-Setup-" + version + ".exe"})
+	}
+	latest := newRelease("v1.1.0")
+	WriteReleases(conf, latest, latest, newRelease("v1.0.0"))
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	// Patches are generated in background.
+	var code int
+	for i := 0; i < 10; i++ {
+		if code, _ = Request(conf.BaseURL, "/patch/exe/1.0.0/latest"); code == 200 {
+			break
+		}
+		<-time.After(200 * time.Millisecond)
+	}
+	if code != 200 {
+		t.Fatalf("expected code is 200, got %v", code)
+	}
+
+	if code, _ := Request(conf.BaseURL, "/patch/exe/0.9.0/1.1.0"); code != 404 {
+		t.Errorf("expected code is 404, got %v", code)
+	}
+
+	_, data := Request(conf.BaseURL, "/update/win/1.0.0")
+	var update struct {
+		Patch gin.H `json:"patch"`
+	}
+	if err := json.Unmarshal(data, &update); err != nil {
+		panic(err)
+	}
+	if update.Patch["url"] != "http://localhost:18080/patch/exe/v1.0.0/v1.1.0" {
+		t.Errorf("unexpected patch in update response: %s", data)
+	}
+}
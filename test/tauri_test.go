@@ -0,0 +1,118 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/panjiang/gohazel/cache"
+)
+
+func TestTauri(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-tauri"
+	conf.Github.Repo = "gohazel-testing"
+	defer os.RemoveAll(conf.CacheDir)
+
+	WriteReleaseData(conf, &cache.ReleaseData{
+		Release: &cache.Release{
+			Version: "v1.1.0",
+			Notes:   "Fixes",
+			Platforms: map[string]*cache.Asset{
+				"darwin": {
+					Name:               "App.app.tar.gz",
+					BrowserDownloadURL: "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/App.app.tar.gz",
+					Signature:          "c2lnbmF0dXJl",
+				},
+				"msi": {
+					Name:               "App_1.1.0_x64_en-US.msi",
+					BrowserDownloadURL: "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/App_1.1.0_x64_en-US.msi",
+				},
+				// Archive of Tauri v1 updater.
+				"AppImage.tar.gz": {
+					Name:               "app_1.1.0_amd64.AppImage.tar.gz",
+					BrowserDownloadURL: "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/app_1.1.0_amd64.AppImage.tar.gz",
+				},
+			},
+		},
+	})
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	tests := []struct {
+		uri  string
+		code int
+		url  string
+	}{
+		{"/tauri/darwin/aarch64/1.0.0", 200, "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/App.app.tar.gz"},
+		{"/tauri/windows/x86_64/1.0.0", 200, "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/App_1.1.0_x64_en-US.msi"},
+		{"/tauri/darwin/x86_64/1.1.0", 204, ""},
+		{"/tauri/linux/x86_64/1.0.0", 200, "https://github.com/atom/gohazel-testing/releases/download/v1.1.0/app_1.1.0_amd64.AppImage.tar.gz"},
+		{"/tauri/linux/aarch64/1.0.0", 204, ""},
+		{"/tauri/android/x86_64/1.0.0", 400, ""},
+		{"/tauri/darwin/x86_64/latest", 400, ""},
+	}
+	for _, tt := range tests {
+		code, data := Request(conf.BaseURL, tt.uri)
+		if code != tt.code {
+			t.Errorf("%s: expected code is %v, got %v", tt.uri, tt.code, code)
+			continue
+		}
+		if tt.url == "" {
+			continue
+		}
+		var update struct {
+			Version   string                       `json:"version"`
+			URL       string                       `json:"url"`
+			Platforms map[string]map[string]string `json:"platforms"`
+		}
+		if err := json.Unmarshal(data, &update); err != nil {
+			panic(err)
+		}
+		if update.Version != "1.1.0" || update.URL != tt.url {
+			t.Errorf("%s: expected update is 1.1.0 %v, got %v %v", tt.uri, tt.url, update.Version, update.URL)
+		}
+		if sig := update.Platforms["darwin-x86_64"]["signature"]; sig != "c2lnbmF0dXJl" {
+			t.Errorf("%s: expected darwin signature, got %q", tt.uri, sig)
+		}
+	}
+}
+
+func TestTauriProxy(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-tauri-proxy"
+	conf.Github.Repo = "gohazel-testing"
+	conf.ProxyDownload = true
+	conf.Update = cache.UpdatePolicy{Pin: cache.PinMajor}
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(version string) *cache.Release {
+		return NewRelease(conf, version, map[string]string{"darwin": "App.app.tar.gz"})
+	}
+	latest := newRelease("v2.0.0")
+	// Only assets of the latest release are cached ahead.
+	WriteReleases(conf, latest, latest)
+	WriteReleaseData(conf, &cache.ReleaseData{
+		Release: latest,
+		History: []*cache.Release{latest, newRelease("v1.2.0")},
+	})
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	_, data := Request(conf.BaseURL, "/tauri/darwin/x86_64/1.0.0")
+	var update struct {
+		Version string `json:"version"`
+		URL     string `json:"url"`
+	}
+	if err := json.Unmarshal(data, &update); err != nil {
+		t.Fatal(err)
+	}
+	if update.Version != "1.2.0" || update.URL != conf.BaseURL+"/assets/atom/gohazel-testing/v1.2.0/App.app.tar.gz" {
+		t.Fatalf("unexpected update of the line: %s", data)
+	}
+	if code, _ := Request(conf.BaseURL, update.URL[len(conf.BaseURL):]); code != 200 {
+		t.Errorf("expected code of the asset is 200, got %v", code)
+	}
+}
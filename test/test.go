@@ -1,11 +1,13 @@
 package test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -40,18 +42,86 @@ func RunServer(conf *config.Config) *server.Server {
 	return s
 }
 
+// WriteReleaseData writes release data into cache dir as cached at last startup.
+func WriteReleaseData(conf *config.Config, data *cache.ReleaseData) {
+	data.RepoURL = conf.Github.RepoURL()
+	data.ProxyDownload = conf.ProxyDownload
+	b, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	if err := os.MkdirAll(conf.CacheDir, os.ModePerm); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(conf.CacheDir, "release.json"), b, 0644); err != nil {
+		panic(err)
+	}
+}
+
+// NewRelease returns a release of version with an asset named by file
+// of each platform, which is downloaded from github release of repo.
+func NewRelease(conf *config.Config, version string, assets map[string]string) *cache.Release {
+	release := &cache.Release{Version: version, Platforms: map[string]*cache.Asset{}}
+	for platform, name := range assets {
+		release.Platforms[platform] = &cache.Asset{
+			Name:               name,
+			BrowserDownloadURL: "https://" + conf.Github.RepoURL() + "/releases/download/" + version + "/" + name,
+		}
+	}
+	return release
+}
+
+// WriteAsset writes an asset file of version into cache dir as downloaded.
+func WriteAsset(conf *config.Config, version string, name string, content []byte) {
+	filename := filepath.Join(conf.CacheDir, conf.Github.Owner, conf.Github.Repo, version, name)
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+		panic(err)
+	}
+}
+
+// WriteReleases writes the platform assets of history into cache dir with their
+// names as content, and the release data with latest as cached at last startup.
+func WriteReleases(conf *config.Config, latest *cache.Release, history ...*cache.Release) {
+	for _, release := range history {
+		for _, asset := range release.Platforms {
+			WriteAsset(conf, release.Version, asset.Name, []byte(asset.Name))
+		}
+	}
+	WriteReleaseData(conf, &cache.ReleaseData{Release: latest, History: history})
+}
+
 // Request send HTTP request to server.
 func Request(baseURL string, uri string) (int, []byte) {
+	return RequestWithHeader(baseURL, uri, nil)
+}
+
+// RequestWithHeader send HTTP request with header to server.
+func RequestWithHeader(baseURL string, uri string, header http.Header) (int, []byte) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		panic(err)
 	}
-	u.Path = path.Join(u.Path, uri)
-	resp, err := http.Get(u.String())
+	ref, err := url.Parse(uri)
+	if err != nil {
+		panic(err)
+	}
+	u.Path = path.Join(u.Path, ref.Path)
+	u.RawQuery = ref.RawQuery
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		panic(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		if strings.Contains(err.Error(), "connection refused") {
 			<-time.After(time.Second)
-			resp, err = http.Get(u.String())
+			resp, err = http.DefaultClient.Do(req)
 			if err != nil {
 				panic(err)
 			}
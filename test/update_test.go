@@ -0,0 +1,231 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjiang/gohazel/cache"
+)
+
+func TestUpdateLines(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-update"
+	conf.Github.Repo = "gohazel-testing"
+	conf.Update = cache.UpdatePolicy{
+		Pin:   cache.PinMajor,
+		Lines: []cache.Line{{Name: "lts", Version: "v3"}},
+	}
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(version string) *cache.Release {
+		return NewRelease(conf, version, map[string]string{"darwin": "App-mac.zip"})
+	}
+	latest := newRelease("v4.1.0")
+	WriteReleases(conf, latest, latest, newRelease("v4.0.0"), newRelease("v3.4.1"), newRelease("v3.4.0"), newRelease("v2.0.0"))
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	tests := []struct {
+		uri     string
+		code    int
+		version string
+	}{
+		{"/update/darwin/3.0.0", 200, "v3.4.1"},
+		{"/update/darwin/3.4.1", 204, ""},
+		{"/update/darwin/3.0.0?allowMajor=true", 200, "v4.1.0"},
+		{"/update/darwin/4.0.0", 200, "v4.1.0"},
+		{"/update/darwin/2.0.0", 204, ""},
+		{"/update/darwin/2.0.0?allowMajor=1", 200, "v4.1.0"},
+		// No release in the line, the lowest newer line is offered.
+		{"/update/darwin/1.0.0", 200, "v2.0.0"},
+	}
+	for _, tt := range tests {
+		code, data := Request(conf.BaseURL, tt.uri)
+		if code != tt.code {
+			t.Errorf("%s: expected code is %v, got %v", tt.uri, tt.code, code)
+			continue
+		}
+		if tt.version == "" {
+			continue
+		}
+		var body gin.H
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["name"] != tt.version {
+			t.Errorf("%s: expected version is %v, got %v", tt.uri, tt.version, body["name"])
+		}
+	}
+
+	_, data := Request(conf.BaseURL, "/api/overview")
+	var overview struct {
+		Lines map[string]string `json:"lines"`
+	}
+	if err := json.Unmarshal(data, &overview); err != nil {
+		t.Fatal(err)
+	}
+	if overview.Lines["lts"] != "v3.4.1" {
+		t.Errorf("unexpected lines: %v", overview.Lines)
+	}
+}
+
+func TestUpdateSteppingStones(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-stones"
+	conf.Github.Repo = "gohazel-testing"
+	conf.Admin.Token = "admin-token"
+	conf.KeepReleases = 2
+	conf.Update = cache.UpdatePolicy{
+		SteppingStones: []cache.SteppingStone{{Version: "v2.9.0", Reason: "Migrate database"}},
+	}
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(version string) *cache.Release {
+		return NewRelease(conf, version, map[string]string{"darwin": "App-mac.zip"})
+	}
+	latest := newRelease("v3.1.0")
+	WriteReleases(conf, latest, latest, newRelease("v3.0.0"), newRelease("v2.9.0"))
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	tests := []struct {
+		uri     string
+		code    int
+		version string
+	}{
+		{"/update/darwin/2.0.0", 200, "v2.9.0"},
+		{"/update/darwin/2.0.0?allowMajor=true", 200, "v2.9.0"},
+		{"/update/darwin/2.9.0", 200, "v3.1.0"},
+		{"/update/darwin/3.0.0", 200, "v3.1.0"},
+	}
+	for _, tt := range tests {
+		code, data := Request(conf.BaseURL, tt.uri)
+		if code != tt.code {
+			t.Errorf("%s: expected code is %v, got %v", tt.uri, tt.code, code)
+			continue
+		}
+		var body gin.H
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["name"] != tt.version {
+			t.Errorf("%s: expected version is %v, got %v", tt.uri, tt.version, body["name"])
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, conf.BaseURL+"/admin/update?version=2.0.0", nil)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var policy struct {
+		SteppingStones []struct {
+			Version   string `json:"version"`
+			Available bool   `json:"available"`
+		} `json:"steppingStones"`
+		Path []string `json:"path"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.SteppingStones) != 1 || !policy.SteppingStones[0].Available {
+		t.Errorf("unexpected stepping stones: %+v", policy.SteppingStones)
+	}
+	if fmt.Sprint(policy.Path) != "[v2.9.0 v3.1.0]" {
+		t.Errorf("unexpected update path: %v", policy.Path)
+	}
+}
+
+func TestUpdateLinesProxy(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-update-proxy"
+	conf.Github.Repo = "gohazel-testing"
+	conf.ProxyDownload = true
+	conf.Update = cache.UpdatePolicy{
+		Lines: []cache.Line{{Name: "lts", Version: "v3"}},
+	}
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(version string) *cache.Release {
+		return NewRelease(conf, version, map[string]string{"darwin": "App-mac.zip"})
+	}
+	latest := newRelease("v4.1.0")
+	WriteReleases(conf, latest, latest, newRelease("v3.4.1"))
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	tests := []struct {
+		uri      string
+		url      string
+		location string
+	}{
+		{"/update/darwin/3.0.0", "/download/darwin/v3.4.1", "/assets/atom/gohazel-testing/v3.4.1/App-mac.zip"},
+		{"/update/darwin/4.0.0", "/download/darwin/v4.1.0", "/assets/atom/gohazel-testing/v4.1.0/App-mac.zip"},
+	}
+	for _, tt := range tests {
+		location := requestUpdateDownload(t, conf.BaseURL, tt.uri, conf.BaseURL+tt.url)
+		if location != conf.BaseURL+tt.location {
+			t.Errorf("%s: expected location is %v, got %v", tt.uri, conf.BaseURL+tt.location, location)
+		}
+	}
+}
+
+func TestUpdateSteppingStonesProxy(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-stones-proxy"
+	conf.Github.Repo = "gohazel-testing"
+	conf.ProxyDownload = true
+	conf.Update = cache.UpdatePolicy{
+		SteppingStones: []cache.SteppingStone{{Version: "v2.9.0", Reason: "Migrate database"}},
+	}
+	defer os.RemoveAll(conf.CacheDir)
+
+	newRelease := func(version string) *cache.Release {
+		return NewRelease(conf, version, map[string]string{"darwin": "App-mac.zip"})
+	}
+	latest := newRelease("v3.1.0")
+	WriteReleases(conf, latest, latest, newRelease("v2.9.0"))
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	location := requestUpdateDownload(t, conf.BaseURL, "/update/darwin/2.0.0", conf.BaseURL+"/download/darwin/v2.9.0")
+	if location != conf.BaseURL+"/assets/atom/gohazel-testing/v2.9.0/App-mac.zip" {
+		t.Errorf("expected location of the stepping stone, got %v", location)
+	}
+}
+
+// requestUpdateDownload checks the download url of update and returns the location it responses.
+func requestUpdateDownload(t *testing.T, baseURL string, uri string, url string) string {
+	code, data := Request(baseURL, uri)
+	if code != 200 {
+		t.Errorf("%s: expected code is 200, got %v", uri, code)
+		return ""
+	}
+	var body gin.H
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["url"] != url {
+		t.Errorf("%s: expected url is %v, got %v", uri, url, body["url"])
+		return ""
+	}
+	_, data = Request(baseURL, url[len(baseURL):])
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	location, _ := body["Location"].(string)
+	return location
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWebhookRefresh(t *testing.T) {
+	conf := DefaultConfig()
+	conf.CacheDir = "/tmp/assets-webhook"
+	conf.Github.WebhookSecret = "webhook-secret"
+	conf.Admin.Token = "admin-token"
+	os.MkdirAll(conf.CacheDir, os.ModePerm)
+	defer os.RemoveAll(conf.CacheDir)
+
+	s := RunServer(conf)
+	defer s.Shutdown()
+
+	// Wait for the server.
+	Request(conf.BaseURL, "/ping")
+
+	sign := func(secret string, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	post := func(uri string, header map[string]string, body string) int {
+		req, err := http.NewRequest(http.MethodPost, conf.BaseURL+uri, strings.NewReader(body))
+		if err != nil {
+			panic(err)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	body := `{"action":"published"}`
+	tests := []struct {
+		event     string
+		signature string
+		code      int
+	}{
+		{"release", "", http.StatusUnauthorized},
+		{"release", sign("wrong", body), http.StatusUnauthorized},
+		{"release", "sha256=zz", http.StatusUnauthorized},
+		{"ping", sign("webhook-secret", body), http.StatusOK},
+		{"release", sign("webhook-secret", body), http.StatusAccepted},
+		{"push", sign("webhook-secret", body), http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		code := post("/webhook/github", map[string]string{"X-GitHub-Event": tt.event, "X-Hub-Signature-256": tt.signature}, body)
+		if code != tt.code {
+			t.Errorf("%s %q: expected code is %v, got %v", tt.event, tt.signature, tt.code, code)
+		}
+	}
+
+	if code := post("/admin/refresh", nil, ""); code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized refresh, got %v", code)
+	}
+	if code := post("/admin/refresh", map[string]string{"Authorization": "Bearer admin-token"}, ""); code != http.StatusAccepted {
+		t.Errorf("expected accepted refresh, got %v", code)
+	}
+}